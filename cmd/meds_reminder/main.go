@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"net/http"
 	"os"
@@ -8,15 +9,41 @@ import (
 	"syscall"
 
 	"github.com/Sush1sui/meds_reminder/internal/bot"
+	"github.com/Sush1sui/meds_reminder/internal/common"
 	"github.com/Sush1sui/meds_reminder/internal/config"
 	"github.com/Sush1sui/meds_reminder/internal/server/routes"
 )
 
 func main() {
+	migrateDryRun := flag.Bool("migrate-dry-run", false, "show what migrating the medication state would change, without saving, and exit")
+	flag.Parse()
+
 	err := config.LoadConfig()
 	if err != nil {
 		panic(err)
 	}
+	if err := common.SetDefaultTimezone(config.GlobalConfig.DefaultTimezone); err != nil {
+		panic(err)
+	}
+	if err := common.SetSeedFile(config.GlobalConfig.SeedFile); err != nil {
+		panic(err)
+	}
+	common.SetDefaultGuild(config.GlobalConfig.DefaultGuildID)
+	if *migrateDryRun {
+		report, err := common.DryRunMigration(config.GlobalConfig.Storage, config.GlobalConfig.SQLitePath)
+		if err != nil {
+			fmt.Printf("Error checking migration: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(report)
+		return
+	}
+	store, err := common.OpenStore(config.GlobalConfig.Storage, config.GlobalConfig.SQLitePath, config.GlobalConfig.StateBackups)
+	if err != nil {
+		panic(err)
+	}
+	defer store.Close()
+	common.SetStore(store)
 
 	addr := fmt.Sprintf(":%s", config.GlobalConfig.ServerPort)
 	router := routes.NewRouter()
@@ -5,13 +5,26 @@ go 1.23
 toolchain go1.23.11
 
 require (
-        github.com/bwmarrin/discordgo v0.29.0
-        github.com/joho/godotenv v1.5.1
+	github.com/bwmarrin/discordgo v0.29.0
+	github.com/joho/godotenv v1.5.1
+	gopkg.in/yaml.v3 v3.0.1
+	modernc.org/sqlite v1.34.5
 )
 
 require (
-        github.com/gorilla/websocket v1.4.2 // indirect
-        github.com/jordan-wright/email v4.0.1-0.20210109023952-943e75fe5223+incompatible
-        golang.org/x/crypto v0.0.0-20210421170649-83a5a9bb288b // indirect
-        golang.org/x/sys v0.0.0-20201119102817-f84b799fce68 // indirect
+	github.com/dustin/go-humanize v1.0.1 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/mattn/go-isatty v0.0.20 // indirect
+	github.com/ncruces/go-strftime v0.1.9 // indirect
+	github.com/remyoudompheng/bigfft v0.0.0-20230129092748-24d4a6f8daec // indirect
+	modernc.org/libc v1.55.3 // indirect
+	modernc.org/mathutil v1.6.0 // indirect
+	modernc.org/memory v1.8.0 // indirect
+)
+
+require (
+	github.com/gorilla/websocket v1.4.2 // indirect
+	github.com/jordan-wright/email v4.0.1-0.20210109023952-943e75fe5223+incompatible
+	golang.org/x/crypto v0.0.0-20210421170649-83a5a9bb288b // indirect
+	golang.org/x/sys v0.22.0 // indirect
 )
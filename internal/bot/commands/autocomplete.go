@@ -0,0 +1,188 @@
+package commands
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Sush1sui/meds_reminder/internal/common"
+	"github.com/bwmarrin/discordgo"
+)
+
+// maxAutocompleteChoices is the most choices Discord accepts in one response
+const maxAutocompleteChoices = 25
+
+// Autocomplete suggests patients for "patient" options, timezones for "zone" options and
+// medications for any other option marked for autocomplete. Medication suggestions are narrowed to the patient
+// already picked in the same command, if any.
+func Autocomplete(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	options := i.ApplicationCommandData().Options
+	// Subcommands and subcommand groups nest their options one level down each
+	for len(options) == 1 && (options[0].Type == discordgo.ApplicationCommandOptionSubCommand || options[0].Type == discordgo.ApplicationCommandOptionSubCommandGroup) {
+		options = options[0].Options
+	}
+
+	var focused *discordgo.ApplicationCommandInteractionDataOption
+	for _, opt := range options {
+		if opt.Focused {
+			focused = opt
+			break
+		}
+	}
+	if focused == nil {
+		respondChoices(s, i, nil)
+		return
+	}
+
+	schedule, err := common.LoadMedicationState()
+	if err != nil {
+		fmt.Printf("Autocomplete error loading medication state: %v\n", err)
+		respondChoices(s, i, nil)
+		return
+	}
+
+	query := strings.TrimSpace(focused.StringValue())
+	switch focused.Name {
+	case "patient":
+		respondChoices(s, i, patientChoices(schedule, i.GuildID, query))
+		return
+	case "zone":
+		respondChoices(s, i, timezoneChoices(query))
+		return
+	}
+
+	patientKey := optString(optionMap(options), "patient")
+	respondChoices(s, i, medicationChoices(schedule, i.GuildID, patientKey, query))
+}
+
+// patientChoices suggests the server's patients whose ID or name matches the query
+func patientChoices(schedule *common.MedicationSchedule, guildID, query string) []*discordgo.ApplicationCommandOptionChoice {
+	type scored struct {
+		score  int
+		choice *discordgo.ApplicationCommandOptionChoice
+	}
+
+	var matches []scored
+	for _, p := range schedule.GuildPatients(guildID) {
+		score := max(fuzzyScore(p.Name, query), fuzzyScore(p.ID, query))
+		if score <= 0 {
+			continue
+		}
+		matches = append(matches, scored{score, &discordgo.ApplicationCommandOptionChoice{
+			Name:  truncate(fmt.Sprintf("%s (%s)", p.Name, p.ID), 100),
+			Value: p.ID,
+		}})
+	}
+
+	sort.SliceStable(matches, func(a, b int) bool { return matches[a].score > matches[b].score })
+
+	choices := make([]*discordgo.ApplicationCommandOptionChoice, 0, len(matches))
+	for _, m := range matches {
+		if len(choices) == maxAutocompleteChoices {
+			break
+		}
+		choices = append(choices, m.choice)
+	}
+	return choices
+}
+
+// medicationChoices suggests the server's medications whose name or indication fuzzily matches the query
+func medicationChoices(schedule *common.MedicationSchedule, guildID, patientKey, query string) []*discordgo.ApplicationCommandOptionChoice {
+	type scored struct {
+		score  int
+		choice *discordgo.ApplicationCommandOptionChoice
+	}
+
+	patients := schedule.GuildPatients(guildID)
+	if patientKey != "" {
+		if p := schedule.GuildPatient(guildID, patientKey); p != nil {
+			patients = []*common.Patient{p}
+		}
+	}
+
+	seen := make(map[string]bool)
+	var matches []scored
+	for _, p := range patients {
+		for _, med := range p.Medications {
+			// Name matches rank above indication matches
+			score := fuzzyScore(med.Name, query) * 2
+			if s := fuzzyScore(med.Indication, query); s > score {
+				score = s
+			}
+			if score <= 0 || seen[strings.ToLower(med.Name)] {
+				continue
+			}
+			seen[strings.ToLower(med.Name)] = true
+
+			label := med.Name
+			if med.Indication != "" {
+				label += " — " + med.Indication
+			}
+			if len(patients) > 1 {
+				label += " (" + p.Name + ")"
+			}
+			matches = append(matches, scored{score, &discordgo.ApplicationCommandOptionChoice{
+				Name:  truncate(label, 100),
+				Value: truncate(med.Name, 100),
+			}})
+		}
+	}
+
+	sort.SliceStable(matches, func(a, b int) bool { return matches[a].score > matches[b].score })
+
+	choices := make([]*discordgo.ApplicationCommandOptionChoice, 0, len(matches))
+	for _, m := range matches {
+		if len(choices) == maxAutocompleteChoices {
+			break
+		}
+		choices = append(choices, m.choice)
+	}
+	return choices
+}
+
+// fuzzyScore rates how well text matches a query: prefix beats word prefix beats
+// substring beats an in-order subsequence of letters. Zero means no match; an empty
+// query matches everything equally.
+func fuzzyScore(text, query string) int {
+	text = strings.ToLower(text)
+	query = strings.ToLower(query)
+
+	switch {
+	case text == "":
+		return 0
+	case query == "":
+		return 1
+	case strings.HasPrefix(text, query):
+		return 40
+	case strings.Contains(text, " "+query) || strings.Contains(text, "("+query):
+		return 30
+	case strings.Contains(text, query):
+		return 20
+	}
+
+	// Subsequence: every query letter appears in order, e.g. "dxy" in "doxycycline"
+	q := []rune(query)
+	pos := 0
+	for _, r := range text {
+		if pos < len(q) && r == q[pos] {
+			pos++
+		}
+	}
+	if pos == len(q) {
+		return 10
+	}
+	return 0
+}
+
+// respondChoices answers an autocomplete interaction
+func respondChoices(s *discordgo.Session, i *discordgo.InteractionCreate, choices []*discordgo.ApplicationCommandOptionChoice) {
+	if choices == nil {
+		choices = []*discordgo.ApplicationCommandOptionChoice{}
+	}
+	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{
+			Choices: choices,
+		},
+	})
+}
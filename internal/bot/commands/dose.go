@@ -0,0 +1,84 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Sush1sui/meds_reminder/internal/common"
+	"github.com/bwmarrin/discordgo"
+)
+
+// DoseButtonHandler records the Taken/Skipped/Snooze outcome of a reminder
+func DoseButtonHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	// Custom ID format: dose:<status>:<reminderID>
+	parts := strings.SplitN(i.MessageComponentData().CustomID, ":", 3)
+	if len(parts) != 3 {
+		respondEphemeral(s, i, "Unknown button.")
+		return
+	}
+	status := common.DoseStatus(parts[1])
+	reminderID := parts[2]
+
+	if status != common.DoseTaken && status != common.DoseSkipped && status != common.DoseSnoozed {
+		respondEphemeral(s, i, "Unknown button.")
+		return
+	}
+
+	// Snoozing first asks for how long
+	if status == common.DoseSnoozed {
+		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseUpdateMessage,
+			Data: &discordgo.InteractionResponseData{
+				Content:    i.Message.Content,
+				Components: common.SnoozeComponents(reminderID),
+			},
+		})
+		return
+	}
+
+	user := interactionUser(i)
+	if user == nil {
+		return
+	}
+
+	now := time.Now()
+	updated, err := common.RecordDoseOutcome(reminderID, status, user.ID, now)
+	if err != nil {
+		respondEphemeral(s, i, "Error recording dose: "+err.Error())
+		return
+	}
+	if len(updated) == 0 {
+		respondEphemeral(s, i, "This reminder was already handled.")
+		return
+	}
+	// A confirmed dose may be the last of a course counted in doses
+	if status == common.DoseTaken {
+		common.RefreshMedicationCounts()
+		common.CheckStock(s, updated[0].Patient)
+	}
+
+	// Replace the buttons with who handled the reminder and when
+	content := i.Message.Content + "\n\n" + doseOutcomeLine(status, user.ID, now)
+	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content:    content,
+			Components: []discordgo.MessageComponent{},
+		},
+	})
+}
+
+// doseOutcomeLine describes how a reminder was handled. The time is a Discord timestamp,
+// so every reader sees it in their own timezone.
+func doseOutcomeLine(status common.DoseStatus, userID string, at time.Time) string {
+	when := fmt.Sprintf("<t:%d:f>", at.Unix())
+	switch status {
+	case common.DoseTaken:
+		return fmt.Sprintf("✅ **Taken** — confirmed by <@%s> at %s", userID, when)
+	case common.DoseSkipped:
+		return fmt.Sprintf("⏭️ **Skipped** — marked by <@%s> at %s", userID, when)
+	default:
+		return fmt.Sprintf("**%s** — marked by <@%s> at %s", status, userID, when)
+	}
+}
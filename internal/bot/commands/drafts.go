@@ -0,0 +1,75 @@
+package commands
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// draftLifetime matches how long Discord keeps an interaction token valid
+const draftLifetime = 15 * time.Minute
+
+// drafts keeps what a multi-step command has filled in so far until it is saved or
+// cancelled, under an ID short enough for a component's custom ID
+type drafts[T any] struct {
+	mutex  sync.Mutex
+	drafts map[string]draft[T]
+	seq    int
+}
+
+// draft is a stored value and when it was stored
+type draft[T any] struct {
+	value   T
+	created time.Time
+}
+
+// newDrafts returns an empty draft store
+func newDrafts[T any]() *drafts[T] {
+	return &drafts[T]{drafts: make(map[string]draft[T])}
+}
+
+// store keeps a draft and returns its ID, dropping drafts that expired
+func (d *drafts[T]) store(value T) string {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	now := time.Now()
+	for id, old := range d.drafts {
+		if now.Sub(old.created) > draftLifetime {
+			delete(d.drafts, id)
+		}
+	}
+
+	d.seq++
+	id := strconv.FormatInt(now.UnixNano(), 36) + strconv.Itoa(d.seq)
+	d.drafts[id] = draft[T]{value: value, created: now}
+	return id
+}
+
+// update changes a draft in place, reporting false when it expired
+func (d *drafts[T]) update(id string, fn func(value *T)) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	stored, ok := d.drafts[id]
+	if !ok || time.Since(stored.created) > draftLifetime {
+		return false
+	}
+	fn(&stored.value)
+	d.drafts[id] = stored
+	return true
+}
+
+// take removes and returns a draft that hasn't expired
+func (d *drafts[T]) take(id string) (T, bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	stored, ok := d.drafts[id]
+	delete(d.drafts, id)
+	if !ok || time.Since(stored.created) > draftLifetime {
+		var zero T
+		return zero, false
+	}
+	return stored.value, true
+}
@@ -0,0 +1,175 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Sush1sui/meds_reminder/internal/common"
+	"github.com/bwmarrin/discordgo"
+)
+
+// interactionUser returns the user behind an interaction in a guild or a DM
+func interactionUser(i *discordgo.InteractionCreate) *discordgo.User {
+	if i.Member != nil && i.Member.User != nil {
+		return i.Member.User
+	}
+	return i.User
+}
+
+// respondEphemeral replies with a message only the invoking user can see
+func respondEphemeral(s *discordgo.Session, i *discordgo.InteractionCreate, content string) {
+	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: content,
+			Flags:   discordgo.MessageFlagsEphemeral,
+		},
+	})
+}
+
+// respondError replies with an error only the invoking user can see
+func respondError(s *discordgo.Session, i *discordgo.InteractionCreate, err error) {
+	respondEphemeral(s, i, "❌ "+errorText(err))
+}
+
+// errorText turns an error into a sentence for a reply, e.g. "no patient named "x""
+// into "No patient named "x"."
+func errorText(err error) string {
+	text := err.Error()
+	first, size := utf8.DecodeRuneInString(text)
+	return string(unicode.ToUpper(first)) + text[size:] + "."
+}
+
+// maxMessageLength is the most characters Discord accepts in one message
+const maxMessageLength = 2000
+
+// splitMessage cuts a message into pieces of at most limit characters, between lines
+// where it can, so each piece can be sent as its own message
+func splitMessage(message string, limit int) []string {
+	var chunks []string
+	var chunk strings.Builder
+	for _, line := range strings.SplitAfter(message, "\n") {
+		for utf8.RuneCountInString(line) > limit {
+			// A line too long for one message is cut wherever the limit falls
+			if chunk.Len() > 0 {
+				chunks = append(chunks, chunk.String())
+				chunk.Reset()
+			}
+			runes := []rune(line)
+			chunks = append(chunks, string(runes[:limit]))
+			line = string(runes[limit:])
+		}
+		if utf8.RuneCountInString(chunk.String())+utf8.RuneCountInString(line) > limit {
+			chunks = append(chunks, chunk.String())
+			chunk.Reset()
+		}
+		chunk.WriteString(line)
+	}
+	if chunk.Len() > 0 || len(chunks) == 0 {
+		chunks = append(chunks, chunk.String())
+	}
+	return chunks
+}
+
+// optionMap indexes command options by name
+func optionMap(options []*discordgo.ApplicationCommandInteractionDataOption) map[string]*discordgo.ApplicationCommandInteractionDataOption {
+	opts := make(map[string]*discordgo.ApplicationCommandInteractionDataOption, len(options))
+	for _, opt := range options {
+		opts[opt.Name] = opt
+	}
+	return opts
+}
+
+// optString returns a string option from an option map, or "" when it wasn't given
+func optString(opts map[string]*discordgo.ApplicationCommandInteractionDataOption, name string) string {
+	if opt, ok := opts[name]; ok {
+		return strings.TrimSpace(opt.StringValue())
+	}
+	return ""
+}
+
+// resolvePatient finds the patient of the server named by a command option. When no
+// patient was given it falls back to the server's only patient, if there is just one.
+func resolvePatient(schedule *common.MedicationSchedule, guildID, key string) (*common.Patient, error) {
+	patients := schedule.GuildPatients(guildID)
+	if key == "" {
+		if len(patients) == 1 {
+			return patients[0], nil
+		}
+		return nil, fmt.Errorf("please choose a patient: %s", patientList(patients))
+	}
+
+	patient := schedule.GuildPatient(guildID, key)
+	if patient == nil {
+		return nil, fmt.Errorf("no patient named %q. Known patients: %s", key, patientList(patients))
+	}
+	return patient, nil
+}
+
+// patientList names every patient for error messages
+func patientList(patients []*common.Patient) string {
+	if len(patients) == 0 {
+		return "none"
+	}
+
+	names := make([]string, 0, len(patients))
+	for _, p := range patients {
+		names = append(names, fmt.Sprintf("%s (%s)", p.Name, p.ID))
+	}
+	return strings.Join(names, ", ")
+}
+
+// updateSchedule changes the medication schedule as one transaction, replying with the
+// error when fn or saving fails, and reports whether it succeeded
+func updateSchedule(s *discordgo.Session, i *discordgo.InteractionCreate, fn func(schedule *common.MedicationSchedule) error) bool {
+	if err := common.UpdateMedicationState(fn); err != nil {
+		respondError(s, i, err)
+		return false
+	}
+	return true
+}
+
+// updateRemaining recounts what is left of a medication's course as of now
+func updateRemaining(patient *common.Patient, med *common.Medication) {
+	doseLog, err := common.LoadDoseLog()
+	if err != nil {
+		fmt.Printf("Error loading dose log: %v\n", err)
+	}
+	med.UpdateRemaining(patient.ID, doseLog, time.Now(), patient.LocationAt)
+}
+
+// findPatientMedication looks a medication up by name. Without a patient it searches the
+// server's patients and only succeeds when exactly one of them has a medication by that name.
+func findPatientMedication(schedule *common.MedicationSchedule, guildID, patientKey, name string) (*common.Patient, *common.Medication, error) {
+	if patientKey != "" {
+		patient, err := resolvePatient(schedule, guildID, patientKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		med := patient.Medication(name)
+		if med == nil {
+			return nil, nil, fmt.Errorf("%s has no medication named %q", patient.Name, name)
+		}
+		return patient, med, nil
+	}
+
+	var (
+		foundPatient *common.Patient
+		foundMed     *common.Medication
+	)
+	for _, patient := range schedule.GuildPatients(guildID) {
+		if med := patient.Medication(name); med != nil {
+			if foundMed != nil {
+				return nil, nil, fmt.Errorf("more than one patient takes %q, please choose a patient", name)
+			}
+			foundPatient, foundMed = patient, med
+		}
+	}
+	if foundMed == nil {
+		return nil, nil, fmt.Errorf("no medication named %q", name)
+	}
+	return foundPatient, foundMed, nil
+}
@@ -0,0 +1,418 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Sush1sui/meds_reminder/internal/common"
+	"github.com/bwmarrin/discordgo"
+)
+
+// MedCommand routes the /med subcommands that change a patient's regimen
+func MedCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	data := i.ApplicationCommandData()
+	if len(data.Options) == 0 {
+		respondEphemeral(s, i, "Please choose a /med subcommand.")
+		return
+	}
+
+	sub := data.Options[0]
+	opts := optionMap(sub.Options)
+
+	switch sub.Name {
+	case "add":
+		medAdd(s, i, opts)
+	case "new":
+		medNew(s, i, opts)
+	case "edit":
+		medEdit(s, i, opts)
+	case "remove":
+		medRemove(s, i, opts)
+	case "phase":
+		medPhase(s, i, sub)
+	case "escalation":
+		medEscalation(s, i, opts)
+	default:
+		respondEphemeral(s, i, "Unknown /med subcommand.")
+	}
+}
+
+// medAdd adds a new medication to a patient
+func medAdd(s *discordgo.Session, i *discordgo.InteractionCreate, opts map[string]*discordgo.ApplicationCommandInteractionDataOption) {
+	days := int64(0)
+	if opt, ok := opts["days"]; ok {
+		days = opt.IntValue()
+	}
+
+	var patient *common.Patient
+	var med common.Medication
+	ok := updateSchedule(s, i, func(schedule *common.MedicationSchedule) error {
+		var err error
+		patient, err = resolvePatient(schedule, i.GuildID, optString(opts, "patient"))
+		if err != nil {
+			return err
+		}
+
+		med, err = buildMedication(patient, optString(opts, "name"), optString(opts, "dose"), optString(opts, "times"), days, optString(opts, "indication"), optString(opts, "notes"))
+		if err != nil {
+			return err
+		}
+		if _, err := applyPRNLimits(&med, opts); err != nil {
+			return err
+		}
+		if _, err := applyRecurrence(&med, opts); err != nil {
+			return err
+		}
+		if opt, ok := opts["start"]; ok {
+			start, err := common.ParseStart(opt.StringValue(), time.Now(), patient.Location())
+			if err != nil {
+				return err
+			}
+			med.Start = start
+		}
+		if _, err := applyWeightDosing(patient, &med, opts); err != nil {
+			return err
+		}
+		if _, err := applyCourseLength(&med, opts); err != nil {
+			return err
+		}
+		// A course starting mid-day only counts the doses still to come that day
+		med.UpdateRemaining(patient.ID, nil, time.Now(), patient.LocationAt)
+		patient.Medications = append(patient.Medications, med)
+		return nil
+	})
+	if !ok {
+		return
+	}
+
+	respondEphemeral(s, i, fmt.Sprintf("✅ Added **%s** for %s.\n\n%s", med.Name, patient.Name, describeMedication(patient, med)))
+}
+
+// buildMedication validates the fields of a new medication for a patient. Its remaining
+// course is left for the caller to count, once every option is applied.
+func buildMedication(patient *common.Patient, name, dose, times string, days int64, indication, notes string) (common.Medication, error) {
+	name = strings.TrimSpace(name)
+	dose = strings.TrimSpace(dose)
+	if name == "" || dose == "" {
+		return common.Medication{}, fmt.Errorf("name and dose are required")
+	}
+	if patient.Medication(name) != nil {
+		return common.Medication{}, fmt.Errorf("%s already has a medication named %q. Use /med edit to change it", patient.Name, name)
+	}
+
+	if days < 0 {
+		return common.Medication{}, fmt.Errorf("days can't be negative, use 0 for an ongoing medication")
+	}
+	parsedDose, err := common.ParseDose(dose)
+	if err != nil {
+		return common.Medication{}, err
+	}
+
+	med := common.Medication{
+		Name:          name,
+		Dose:          parsedDose,
+		DaysRemaining: int(days),
+		TotalDays:     int(days),
+		Indication:    strings.TrimSpace(indication),
+		Notes:         strings.TrimSpace(notes),
+		Active:        true,
+		Start:         time.Now().Truncate(time.Minute),
+	}
+	if err := applySchedule(patient, &med, times); err != nil {
+		return common.Medication{}, err
+	}
+	return med, nil
+}
+
+// applySchedule reads a times option into a medication: 24h times of day, an interval
+// like "every 8h", or "as needed". An as-needed medication keeps its earlier limits, and
+// intervals and as-needed doses drop any repeat rule, which only fits fixed times.
+func applySchedule(patient *common.Patient, med *common.Medication, value string) error {
+	switch {
+	case common.IsPRNSpec(value):
+		if med.PRN == nil {
+			med.PRN = &common.PRNRule{}
+		}
+		med.Times, med.Interval, med.Recurrence = nil, nil, nil
+	case common.IsIntervalSpec(value):
+		interval, err := common.ParseInterval(value, time.Now(), patient.Location())
+		if err != nil {
+			return err
+		}
+		med.Times, med.Interval, med.PRN, med.Recurrence = nil, interval, nil, nil
+	default:
+		times, err := common.ParseTimes(value)
+		if err != nil {
+			return err
+		}
+		med.Times, med.Interval, med.PRN = times, nil, nil
+	}
+	return nil
+}
+
+// applyRecurrence sets which days a medication is taken on from the repeat option
+func applyRecurrence(med *common.Medication, opts map[string]*discordgo.ApplicationCommandInteractionDataOption) (bool, error) {
+	opt, ok := opts["repeat"]
+	if !ok {
+		return false, nil
+	}
+
+	rule, err := common.ParseRecurrence(opt.StringValue())
+	if err != nil {
+		return false, err
+	}
+	if rule != nil && (med.Interval != nil || med.PRN != nil) {
+		return false, fmt.Errorf("repeat only applies to medications taken at fixed times, not %s", med.ScheduleText())
+	}
+	med.Recurrence = rule
+	return true, nil
+}
+
+// applyCourseLength reads the days and doses options into a medication's course length.
+// A course is counted in one or the other, so setting one clears the other.
+func applyCourseLength(med *common.Medication, opts map[string]*discordgo.ApplicationCommandInteractionDataOption) (bool, error) {
+	daysOpt, hasDays := opts["days"]
+	dosesOpt, hasDoses := opts["doses"]
+	if !hasDays && !hasDoses {
+		return false, nil
+	}
+
+	days, doses := int64(0), int64(0)
+	if hasDays {
+		days = daysOpt.IntValue()
+	}
+	if hasDoses {
+		doses = dosesOpt.IntValue()
+	}
+	if days > 0 && doses > 0 {
+		return false, fmt.Errorf("give the course length in either days or doses, not both")
+	}
+
+	med.TotalDays, med.DaysRemaining = int(days), int(days)
+	med.TotalDoses, med.DosesRemaining = int(doses), int(doses)
+	return true, nil
+}
+
+// applyWeightDosing sets the mg/kg and concentration options and recomputes the dose from
+// the patient's latest weight
+func applyWeightDosing(patient *common.Patient, med *common.Medication, opts map[string]*discordgo.ApplicationCommandInteractionDataOption) (bool, error) {
+	mgPerKg, hasMgPerKg := opts["mg_per_kg"]
+	concentration, hasConcentration := opts["concentration"]
+	if !hasMgPerKg && !hasConcentration {
+		return false, nil
+	}
+
+	if hasMgPerKg {
+		med.MgPerKg = mgPerKg.FloatValue()
+	}
+	if hasConcentration {
+		c, err := common.ParseConcentration(concentration.StringValue())
+		if err != nil {
+			return false, err
+		}
+		med.Concentration = c
+	}
+
+	doseLog, err := common.LoadDoseLog()
+	if err != nil {
+		fmt.Printf("Error loading dose log: %v\n", err)
+	}
+	common.ApplyWeightDose(patient, med, doseLog, time.Now())
+	return true, nil
+}
+
+// applyPRNLimits sets the spacing and daily cap options of an as-needed medication
+func applyPRNLimits(med *common.Medication, opts map[string]*discordgo.ApplicationCommandInteractionDataOption) (bool, error) {
+	spacing, hasSpacing := opts["spacing"]
+	maxDaily, hasMax := opts["max_daily"]
+	if !hasSpacing && !hasMax {
+		return false, nil
+	}
+	if med.PRN == nil {
+		return false, fmt.Errorf("spacing and max_daily only apply to as-needed medications, set times to \"as needed\" first")
+	}
+
+	if hasSpacing {
+		med.PRN.MinHoursApart = int(spacing.IntValue())
+	}
+	if hasMax {
+		med.PRN.MaxPer24h = int(maxDaily.IntValue())
+	}
+	return true, nil
+}
+
+// medEdit changes the dose, times, course length, notes or indication of a medication
+func medEdit(s *discordgo.Session, i *discordgo.InteractionCreate, opts map[string]*discordgo.ApplicationCommandInteractionDataOption) {
+	var patient *common.Patient
+	var med *common.Medication
+	var changes []string
+	ok := updateSchedule(s, i, func(schedule *common.MedicationSchedule) error {
+		var err error
+		patient, med, err = findPatientMedication(schedule, i.GuildID, optString(opts, "patient"), optString(opts, "name"))
+		if err != nil {
+			return err
+		}
+		changes, err = editMedication(patient, med, opts)
+		return err
+	})
+	if !ok {
+		return
+	}
+
+	respondEphemeral(s, i, fmt.Sprintf("✏️ Updated %s of %s's **%s**.\n\n%s", strings.Join(changes, ", "), patient.Name, med.Name, describeMedication(patient, *med)))
+}
+
+// editMedication applies the /med edit options to a medication and names what changed
+func editMedication(patient *common.Patient, med *common.Medication, opts map[string]*discordgo.ApplicationCommandInteractionDataOption) ([]string, error) {
+	var changes []string
+	if opt, ok := opts["start"]; ok {
+		start, err := common.ParseStart(opt.StringValue(), time.Now(), patient.Location())
+		if err != nil {
+			return nil, err
+		}
+		med.Start = start
+		changes = append(changes, "start")
+	}
+	if opt, ok := opts["dose"]; ok {
+		dose, err := common.ParseDose(opt.StringValue())
+		if err != nil {
+			return nil, err
+		}
+		med.Dose = dose
+		changes = append(changes, "dose")
+	}
+	weightChanged, err := applyWeightDosing(patient, med, opts)
+	if err != nil {
+		return nil, err
+	}
+	if weightChanged {
+		changes = append(changes, "dose by weight")
+	}
+	if opt, ok := opts["times"]; ok {
+		if len(med.Phases) > 0 {
+			return nil, fmt.Errorf("**%s** follows a phased regimen, use /med phase to change its times", med.Name)
+		}
+		if err := applySchedule(patient, med, opt.StringValue()); err != nil {
+			return nil, err
+		}
+		changes = append(changes, "times")
+	}
+	limitsChanged, err := applyPRNLimits(med, opts)
+	if err != nil {
+		return nil, err
+	}
+	if limitsChanged {
+		changes = append(changes, "as-needed limits")
+	}
+	repeatChanged, err := applyRecurrence(med, opts)
+	if err != nil {
+		return nil, err
+	}
+	if repeatChanged {
+		changes = append(changes, "repeat")
+	}
+	lengthChanged, err := applyCourseLength(med, opts)
+	if err != nil {
+		return nil, err
+	}
+	if lengthChanged {
+		changes = append(changes, "duration")
+	}
+	if opts["start"] != nil || lengthChanged {
+		// A longer or later course brings a finished medication back
+		med.Active = true
+	}
+	if opts["start"] != nil || lengthChanged || opts["times"] != nil || repeatChanged {
+		// Other times or days change how many doses are left
+		updateRemaining(patient, med)
+	}
+	if opt, ok := opts["indication"]; ok {
+		med.Indication = strings.TrimSpace(opt.StringValue())
+		changes = append(changes, "indication")
+	}
+	if opt, ok := opts["notes"]; ok {
+		med.Notes = strings.TrimSpace(opt.StringValue())
+		changes = append(changes, "notes")
+	}
+
+	if len(changes) == 0 {
+		return nil, errors.New("nothing to change, pass at least one of dose, times, repeat, days, doses, start, indication, notes, spacing, max_daily, mg_per_kg or concentration")
+	}
+	return changes, nil
+}
+
+// medRemove deletes a medication from a patient
+func medRemove(s *discordgo.Session, i *discordgo.InteractionCreate, opts map[string]*discordgo.ApplicationCommandInteractionDataOption) {
+	var patient *common.Patient
+	var name string
+	ok := updateSchedule(s, i, func(schedule *common.MedicationSchedule) error {
+		var med *common.Medication
+		var err error
+		patient, med, err = findPatientMedication(schedule, i.GuildID, optString(opts, "patient"), optString(opts, "name"))
+		if err != nil {
+			return err
+		}
+
+		name = med.Name
+		for idx := range patient.Medications {
+			if patient.Medications[idx].Name == name {
+				patient.Medications = append(patient.Medications[:idx], patient.Medications[idx+1:]...)
+				break
+			}
+		}
+		return nil
+	})
+	if !ok {
+		return
+	}
+
+	respondEphemeral(s, i, fmt.Sprintf("🗑️ Removed **%s** from %s's schedule.", name, patient.Name))
+}
+
+// describeMedication summarizes a medication for command replies
+func describeMedication(patient *common.Patient, med common.Medication) string {
+	msg := fmt.Sprintf("💊 **%s**\n", med.Name)
+	msg += fmt.Sprintf("   📏 Dose: %s\n", med.Dose)
+	if basis := med.WeightBasis(patient); basis != "" {
+		msg += fmt.Sprintf("   ⚖️ By weight: %s\n", basis)
+	} else if med.MgPerKg > 0 {
+		msg += fmt.Sprintf("   ⚖️ %s mg/kg, record %s's weight with /weight to compute the dose\n", strconv.FormatFloat(med.MgPerKg, 'f', -1, 64), patient.Name)
+	}
+	if len(med.Phases) > 0 {
+		msg += "   📉 Phases:\n"
+		day, _ := med.CourseDay(time.Now(), patient.LocationAt)
+		for _, line := range strings.Split(common.FormatPhases(med, day), "\n") {
+			msg += "      " + line + "\n"
+		}
+	} else {
+		msg += fmt.Sprintf("   ⏰ Times: %s\n", med.ScheduleText())
+	}
+	if med.Interval != nil {
+		msg += fmt.Sprintf("   ⏭️ First dose: %s\n", med.Interval.Start.In(patient.LocationAt(med.Interval.Start)).Format("Jan 2 15:04"))
+	}
+	if med.Recurrence != nil {
+		msg += fmt.Sprintf("   🗓️ Repeats: %s\n", med.Recurrence)
+		if next, ok := med.NextDoseTime(time.Now(), patient.LocationAt); ok {
+			msg += fmt.Sprintf("   ⏭️ Next dose: %s\n", next.In(patient.LocationAt(next)).Format("Mon, Jan 2 15:04"))
+		}
+	}
+	if med.Indication != "" {
+		msg += fmt.Sprintf("   🏥 Purpose: %s\n", med.Indication)
+	}
+	msg += fmt.Sprintf("   🚩 Started: %s\n", med.Start.In(patient.LocationAt(med.Start)).Format("Jan 2, 2006 15:04"))
+	if med.TotalDays > 0 || med.TotalDoses > 0 {
+		msg += fmt.Sprintf("   📅 Remaining: %s\n", med.RemainingText())
+	} else {
+		msg += "   📅 Ongoing\n"
+	}
+	if med.Escalation != nil {
+		msg += fmt.Sprintf("   🔔 Escalation: %s\n", med.Escalation)
+	}
+	if med.Notes != "" {
+		msg += fmt.Sprintf("   ℹ️ Note: %s\n", med.Notes)
+	}
+	return msg
+}
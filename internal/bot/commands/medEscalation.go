@@ -0,0 +1,120 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Sush1sui/meds_reminder/internal/common"
+	"github.com/bwmarrin/discordgo"
+)
+
+// escalationOptions are the /med escalation options that change the policy
+var escalationOptions = []string{"remind_after", "caregiver_after", "caregivers", "email", "channel_after", "channel"}
+
+// medEscalation shows or changes who is told when a medication's doses go unconfirmed
+func medEscalation(s *discordgo.Session, i *discordgo.InteractionCreate, opts map[string]*discordgo.ApplicationCommandInteractionDataOption) {
+	var patient *common.Patient
+	var med *common.Medication
+	var changed bool
+	ok := updateSchedule(s, i, func(schedule *common.MedicationSchedule) error {
+		var err error
+		patient, med, err = findPatientMedication(schedule, i.GuildID, optString(opts, "patient"), optString(opts, "name"))
+		if err != nil {
+			return err
+		}
+		changed, err = applyEscalation(med, opts, time.Now())
+		if err != nil {
+			return err
+		}
+		if !changed {
+			return common.ErrNoChanges
+		}
+		return nil
+	})
+	if !ok {
+		return
+	}
+
+	if med.Escalation == nil {
+		if changed {
+			respondEphemeral(s, i, fmt.Sprintf("🔕 Unconfirmed doses of %s's **%s** are no longer escalated.", patient.Name, med.Name))
+		} else {
+			respondEphemeral(s, i, fmt.Sprintf("🔕 Unconfirmed doses of %s's **%s** aren't escalated. Set remind_after, caregiver_after or channel_after to start.", patient.Name, med.Name))
+		}
+		return
+	}
+	verb := "are escalated"
+	if changed {
+		verb = "will now be escalated"
+	}
+	respondEphemeral(s, i, fmt.Sprintf("🔔 Unconfirmed doses of %s's **%s** %s: %s.", patient.Name, med.Name, verb, med.Escalation))
+}
+
+// applyEscalation applies the /med escalation options to a medication and reports whether
+// its policy changed. A new policy only escalates doses due from now on.
+func applyEscalation(med *common.Medication, opts map[string]*discordgo.ApplicationCommandInteractionDataOption, now time.Time) (bool, error) {
+	if opt, ok := opts["off"]; ok && opt.BoolValue() {
+		for _, name := range escalationOptions {
+			if _, ok := opts[name]; ok {
+				return false, fmt.Errorf("off can't be combined with %s", name)
+			}
+		}
+		changed := med.Escalation != nil
+		med.Escalation = nil
+		return changed, nil
+	}
+
+	policy := common.EscalationPolicy{SetAt: now}
+	if med.Escalation != nil {
+		policy = *med.Escalation
+	}
+	changed := false
+	if opt, ok := opts["remind_after"]; ok {
+		policy.RemindAfter = int(opt.IntValue())
+		changed = true
+	}
+	if opt, ok := opts["caregiver_after"]; ok {
+		policy.CaregiverAfter = int(opt.IntValue())
+		changed = true
+	}
+	if opt, ok := opts["caregivers"]; ok {
+		policy.CaregiverIDs = parseUserIDs(opt.StringValue())
+		changed = true
+	}
+	if opt, ok := opts["email"]; ok {
+		policy.EmailCaregivers = opt.BoolValue()
+		changed = true
+	}
+	if opt, ok := opts["channel_after"]; ok {
+		policy.ChannelAfter = int(opt.IntValue())
+		changed = true
+	}
+	if opt, ok := opts["channel"]; ok {
+		policy.ChannelID = opt.ChannelValue(nil).ID
+		changed = true
+	}
+	if !changed {
+		return false, nil
+	}
+
+	if policy.CaregiverAfter > 0 && len(policy.CaregiverIDs) == 0 && !policy.EmailCaregivers {
+		return false, fmt.Errorf("caregiver_after needs caregivers to notify, or email turned on")
+	}
+	if policy.ChannelAfter > 0 && policy.ChannelID == "" {
+		return false, fmt.Errorf("channel_after needs a channel to post in")
+	}
+	if policy.Enabled() {
+		med.Escalation = &policy
+	} else {
+		med.Escalation = nil
+	}
+	return true, nil
+}
+
+// parseUserIDs reads Discord user IDs from mentions or plain IDs, so "none" gives none
+func parseUserIDs(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return r < '0' || r > '9'
+	})
+}
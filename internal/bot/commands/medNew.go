@@ -0,0 +1,247 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Sush1sui/meds_reminder/internal/common"
+	"github.com/bwmarrin/discordgo"
+)
+
+// Custom ID prefixes of the /med new modal and its confirmation buttons
+const (
+	MedNewModalPrefix = "mednew"
+	MedConfirmPrefix  = "medconfirm"
+)
+
+// medModalMaxTextSize caps each text input of the modal
+const medModalMaxTextSize = 1000
+
+// medDraft is a validated medication waiting for Save or Cancel
+type medDraft struct {
+	patientID string
+	med       common.Medication
+}
+
+// medDrafts keeps each draft between the modal and its buttons
+var medDrafts = newDrafts[medDraft]()
+
+// medNew opens the modal form for adding a medication
+func medNew(s *discordgo.Session, i *discordgo.InteractionCreate, opts map[string]*discordgo.ApplicationCommandInteractionDataOption) {
+	schedule, err := common.LoadMedicationState()
+	if err != nil {
+		respondEphemeral(s, i, "Error loading medication schedule: "+err.Error())
+		return
+	}
+
+	patient, err := resolvePatient(schedule, i.GuildID, optString(opts, "patient"))
+	if err != nil {
+		respondError(s, i, err)
+		return
+	}
+
+	// Discord allows five inputs per modal, so indication and notes share the last one
+	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseModal,
+		Data: &discordgo.InteractionResponseData{
+			CustomID: MedNewModalPrefix + ":" + patient.ID,
+			Title:    truncate("New medication for "+patient.Name, 45),
+			Components: []discordgo.MessageComponent{
+				textInputRow("name", "Name", "e.g. Doxycycline 50mg/ml", discordgo.TextInputShort, true),
+				textInputRow("dose", "Dose", "e.g. 2 ml or 1/2 tab", discordgo.TextInputShort, true),
+				textInputRow("times", "Times (24h, comma separated) or interval", "e.g. 08:00, 20:00 / every 8h from 07:00 / as needed", discordgo.TextInputShort, true),
+				textInputRow("days", "Course length (empty or 0 for ongoing)", "e.g. 7 days or 14 doses", discordgo.TextInputShort, false),
+				textInputRow("details", "Indication (first line) and notes", "Antibacterial\nGive after meals", discordgo.TextInputParagraph, false),
+			},
+		},
+	})
+}
+
+// MedNewModalHandler validates the submitted form and asks for confirmation
+func MedNewModalHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	data := i.ModalSubmitData()
+	_, patientID, _ := strings.Cut(data.CustomID, ":")
+	values := modalValues(data)
+
+	schedule, err := common.LoadMedicationState()
+	if err != nil {
+		respondEphemeral(s, i, "Error loading medication schedule: "+err.Error())
+		return
+	}
+	patient := schedule.Patient(patientID)
+	if patient == nil {
+		respondEphemeral(s, i, fmt.Sprintf("Patient %q no longer exists.", patientID))
+		return
+	}
+
+	days, doses, err := common.ParseCourseLength(values["days"])
+	if err != nil {
+		respondEphemeral(s, i, "❌ "+errorText(err)+" Please run /med new again.")
+		return
+	}
+
+	indication, notes, _ := strings.Cut(strings.TrimSpace(values["details"]), "\n")
+	med, err := buildMedication(patient, values["name"], values["dose"], values["times"], int64(days), indication, notes)
+	if err != nil {
+		respondEphemeral(s, i, "❌ "+errorText(err)+" Please run /med new again.")
+		return
+	}
+	med.TotalDoses, med.DosesRemaining = doses, doses
+	// A course starting mid-day only counts the doses still to come that day
+	med.UpdateRemaining(patient.ID, nil, time.Now(), patient.LocationAt)
+
+	draftID := medDrafts.store(medDraft{patientID: patient.ID, med: med})
+
+	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: "Please check the new medication before saving:",
+			Embeds:  []*discordgo.MessageEmbed{medicationEmbed(patient, med)},
+			Components: []discordgo.MessageComponent{
+				discordgo.ActionsRow{
+					Components: []discordgo.MessageComponent{
+						discordgo.Button{
+							Label:    "Save",
+							Style:    discordgo.SuccessButton,
+							CustomID: MedConfirmPrefix + ":save:" + draftID,
+						},
+						discordgo.Button{
+							Label:    "Cancel",
+							Style:    discordgo.SecondaryButton,
+							CustomID: MedConfirmPrefix + ":cancel:" + draftID,
+						},
+					},
+				},
+			},
+			Flags: discordgo.MessageFlagsEphemeral,
+		},
+	})
+}
+
+// MedConfirmHandler saves or discards a medication drafted through the modal
+func MedConfirmHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	// Custom ID format: medconfirm:<save|cancel>:<draftID>
+	parts := strings.SplitN(i.MessageComponentData().CustomID, ":", 3)
+	if len(parts) != 3 {
+		respondEphemeral(s, i, "Unknown button.")
+		return
+	}
+
+	draft, ok := medDrafts.take(parts[2])
+	if !ok {
+		updateMessage(s, i, "⌛ This draft has expired. Please run /med new again.", nil)
+		return
+	}
+
+	if parts[1] != "save" {
+		updateMessage(s, i, "Cancelled, nothing was saved.", nil)
+		return
+	}
+
+	var patient *common.Patient
+	err := common.UpdateMedicationState(func(schedule *common.MedicationSchedule) error {
+		patient = schedule.Patient(draft.patientID)
+		if patient == nil {
+			return fmt.Errorf("patient %q no longer exists", draft.patientID)
+		}
+		if patient.Medication(draft.med.Name) != nil {
+			return fmt.Errorf("%s already has a medication named %q", patient.Name, draft.med.Name)
+		}
+		patient.Medications = append(patient.Medications, draft.med)
+		return nil
+	})
+	if err != nil {
+		updateMessage(s, i, "❌ "+errorText(err), nil)
+		return
+	}
+
+	updateMessage(s, i, fmt.Sprintf("✅ Added **%s** for %s.", draft.med.Name, patient.Name), []*discordgo.MessageEmbed{medicationEmbed(patient, draft.med)})
+}
+
+// medicationEmbed shows a medication's fields for review
+func medicationEmbed(patient *common.Patient, med common.Medication) *discordgo.MessageEmbed {
+	days := "Ongoing"
+	if med.TotalDoses > 0 {
+		days = fmt.Sprintf("%d doses", med.TotalDoses)
+	} else if med.TotalDays > 0 {
+		days = fmt.Sprintf("%d days", med.TotalDays)
+	}
+
+	fields := []*discordgo.MessageEmbedField{
+		{Name: "Patient", Value: patient.Name, Inline: true},
+		{Name: "Dose", Value: med.Dose.String(), Inline: true},
+		{Name: "Times", Value: med.ScheduleText(), Inline: true},
+		{Name: "Course", Value: days, Inline: true},
+		{Name: "Starts", Value: med.Start.In(patient.LocationAt(med.Start)).Format("Jan 2 15:04"), Inline: true},
+	}
+	if med.Indication != "" {
+		fields = append(fields, &discordgo.MessageEmbedField{Name: "Purpose", Value: med.Indication})
+	}
+	if med.Notes != "" {
+		fields = append(fields, &discordgo.MessageEmbedField{Name: "Notes", Value: med.Notes})
+	}
+
+	return &discordgo.MessageEmbed{
+		Title:  "💊 " + med.Name,
+		Color:  0x57F287,
+		Fields: fields,
+	}
+}
+
+// textInputRow builds one modal text input
+func textInputRow(id, label, placeholder string, style discordgo.TextInputStyle, required bool) discordgo.ActionsRow {
+	return discordgo.ActionsRow{
+		Components: []discordgo.MessageComponent{
+			discordgo.TextInput{
+				CustomID:    id,
+				Label:       label,
+				Style:       style,
+				Placeholder: placeholder,
+				Required:    required,
+				MaxLength:   medModalMaxTextSize,
+			},
+		},
+	}
+}
+
+// modalValues collects submitted text inputs by custom ID
+func modalValues(data discordgo.ModalSubmitInteractionData) map[string]string {
+	values := make(map[string]string)
+	for _, row := range data.Components {
+		actions, ok := row.(*discordgo.ActionsRow)
+		if !ok {
+			continue
+		}
+		for _, c := range actions.Components {
+			if input, ok := c.(*discordgo.TextInput); ok {
+				values[input.CustomID] = input.Value
+			}
+		}
+	}
+	return values
+}
+
+// updateMessage replaces the message a button belongs to and removes its buttons
+func updateMessage(s *discordgo.Session, i *discordgo.InteractionCreate, content string, embeds []*discordgo.MessageEmbed) {
+	if embeds == nil {
+		embeds = []*discordgo.MessageEmbed{}
+	}
+	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content:    content,
+			Embeds:     embeds,
+			Components: []discordgo.MessageComponent{},
+		},
+	})
+}
+
+// truncate shortens text to at most max characters
+func truncate(text string, max int) string {
+	runes := []rune(text)
+	if len(runes) <= max {
+		return text
+	}
+	return string(runes[:max-1]) + "…"
+}
@@ -0,0 +1,114 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/Sush1sui/meds_reminder/internal/common"
+	"github.com/bwmarrin/discordgo"
+)
+
+// medPhase routes the /med phase subcommands that build a tapering regimen
+func medPhase(s *discordgo.Session, i *discordgo.InteractionCreate, group *discordgo.ApplicationCommandInteractionDataOption) {
+	if len(group.Options) == 0 {
+		respondEphemeral(s, i, "Please choose a /med phase subcommand.")
+		return
+	}
+
+	sub := group.Options[0]
+	opts := optionMap(sub.Options)
+
+	switch sub.Name {
+	case "add":
+		medPhaseAdd(s, i, opts)
+	case "clear":
+		medPhaseClear(s, i, opts)
+	default:
+		respondEphemeral(s, i, "Unknown /med phase subcommand.")
+	}
+}
+
+// medPhaseAdd adds a phase to a medication. Once a medication has phases, its times
+// and dose come from whichever phase covers the current day of the course.
+func medPhaseAdd(s *discordgo.Session, i *discordgo.InteractionCreate, opts map[string]*discordgo.ApplicationCommandInteractionDataOption) {
+	var patient *common.Patient
+	var med *common.Medication
+	var phase common.Phase
+	ok := updateSchedule(s, i, func(schedule *common.MedicationSchedule) error {
+		var err error
+		patient, med, err = findPatientMedication(schedule, i.GuildID, optString(opts, "patient"), optString(opts, "name"))
+		if err != nil {
+			return err
+		}
+
+		if med.Interval != nil || med.PRN != nil {
+			return fmt.Errorf("**%s** is taken %s and can't have phases", med.Name, med.ScheduleText())
+		}
+
+		times, err := common.ParseTimes(optString(opts, "times"))
+		if err != nil {
+			return err
+		}
+
+		phase = common.Phase{
+			Times: times,
+			Notes: optString(opts, "notes"),
+		}
+		if text := optString(opts, "dose"); text != "" {
+			dose, err := common.ParseDose(text)
+			if err != nil {
+				return err
+			}
+			phase.Dose = &dose
+		}
+		if opt, ok := opts["from"]; ok {
+			phase.FromDay = int(opt.IntValue())
+		}
+		if opt, ok := opts["to"]; ok {
+			phase.ToDay = int(opt.IntValue())
+		}
+
+		phases := append(append([]common.Phase{}, med.Phases...), phase)
+		common.SortPhases(phases)
+		if err := common.ValidatePhases(phases); err != nil {
+			return err
+		}
+		med.Phases = phases
+
+		// A taper whose last phase has an end finishes with it
+		if last := phases[len(phases)-1]; last.ToDay > 0 && last.ToDay != med.TotalDays {
+			med.TotalDays = last.ToDay
+			med.Active = true
+			updateRemaining(patient, med)
+		}
+		return nil
+	})
+	if !ok {
+		return
+	}
+
+	respondEphemeral(s, i, fmt.Sprintf("📉 Added %s to %s's **%s**.\n\n%s", phase.Days(), patient.Name, med.Name, describeMedication(patient, *med)))
+}
+
+// medPhaseClear removes every phase, so the medication goes back to its plain times and dose
+func medPhaseClear(s *discordgo.Session, i *discordgo.InteractionCreate, opts map[string]*discordgo.ApplicationCommandInteractionDataOption) {
+	var patient *common.Patient
+	var med *common.Medication
+	ok := updateSchedule(s, i, func(schedule *common.MedicationSchedule) error {
+		var err error
+		patient, med, err = findPatientMedication(schedule, i.GuildID, optString(opts, "patient"), optString(opts, "name"))
+		if err != nil {
+			return err
+		}
+		if len(med.Phases) == 0 {
+			return fmt.Errorf("**%s** has no phases", med.Name)
+		}
+
+		med.Phases = nil
+		return nil
+	})
+	if !ok {
+		return
+	}
+
+	respondEphemeral(s, i, fmt.Sprintf("Cleared the phases of %s's **%s**.\n\n%s", patient.Name, med.Name, describeMedication(patient, *med)))
+}
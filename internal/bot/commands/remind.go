@@ -12,41 +12,42 @@ func RemindCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		return
 	}
 
-	// Get the user choice
-	options := i.ApplicationCommandData().Options
-	if len(options) == 0 {
-		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-			Type: discordgo.InteractionResponseChannelMessageWithSource,
-			Data: &discordgo.InteractionResponseData{
-				Content: "Please select a user to remind.",
-				Flags:   discordgo.MessageFlagsEphemeral,
-			},
-		})
+	opts := optionMap(i.ApplicationCommandData().Options)
+
+	schedule, err := common.LoadMedicationState()
+	if err != nil {
+		respondEphemeral(s, i, "Error loading medication schedule: "+err.Error())
 		return
 	}
 
-	userChoice := options[0].StringValue()
+	patient, err := resolvePatient(schedule, i.GuildID, optString(opts, "patient"))
+	if err != nil {
+		respondError(s, i, err)
+		return
+	}
 
-	// Validate user choice
-	if userChoice != "jp" && userChoice != "dane" {
-		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-			Type: discordgo.InteractionResponseChannelMessageWithSource,
-			Data: &discordgo.InteractionResponseData{
-				Content: "Invalid selection. Please choose JP or Dane.",
-				Flags:   discordgo.MessageFlagsEphemeral,
-			},
-		})
+	// Default to the medication list, or the plain greeting when there is nothing to list
+	kind := optString(opts, "kind")
+	if kind == "" {
+		kind = "medications"
+		if !patient.HasActiveMedications() {
+			kind = "simple"
+		}
+	}
+	if kind != "medications" && kind != "simple" {
+		respondEphemeral(s, i, "Invalid reminder type. Please choose medications or simple.")
 		return
 	}
 
 	// acknowledge immediately so we have time to do work
-    _ = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-        Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
-        Data: &discordgo.InteractionResponseData{
-            Flags: discordgo.MessageFlagsEphemeral,
-        },
-    })
+	_ = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Flags: discordgo.MessageFlagsEphemeral,
+		},
+	})
 
+	patientID := patient.ID
 	go func() {
 		defer func() {
 			if r := recover(); r != nil {
@@ -55,22 +56,22 @@ func RemindCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		}()
 
 		// send reminder based on choice
-		if userChoice == "jp" {
-			common.RemindUserManual(s) // Use manual version for testing
-		} else if userChoice == "dane" {
-			common.SendSimpleReminder(s)
+		if kind == "medications" {
+			common.RemindUserManual(s, patientID) // Use manual version for testing
+		} else {
+			common.SendSimpleReminder(s, patientID)
 		}
 	}()
 
 	// final response
 	var responseMsg string
-	if userChoice == "jp" {
-		responseMsg = "JP medication reminder sent. Check logs for details."
+	if kind == "medications" {
+		responseMsg = fmt.Sprintf("%s medication reminder sent. Check logs for details.", patient.Name)
 	} else {
-		responseMsg = "Dane simple reminder sent. Check logs for details."
+		responseMsg = fmt.Sprintf("%s simple reminder sent. Check logs for details.", patient.Name)
 	}
 
 	_, _ = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
 		Content: func(s string) *string { return &s }(responseMsg),
 	})
-}
\ No newline at end of file
+}
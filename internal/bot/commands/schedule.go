@@ -1,11 +1,17 @@
 package commands
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/Sush1sui/meds_reminder/internal/common"
 	"github.com/bwmarrin/discordgo"
 )
 
 func ScheduleCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	// Update counts
+	common.RefreshMedicationCounts()
+
 	// Load medication schedule
 	schedule, err := common.LoadMedicationState()
 	if err != nil {
@@ -19,18 +25,48 @@ func ScheduleCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		return
 	}
 
-	// Update counts
-	common.UpdateMedicationCounts(schedule)
-
-	// Get formatted schedule
-	scheduleMsg := common.GetAllActiveMedications(schedule)
+	// Get formatted schedule for the chosen patient, or the server's patients when none was chosen
+	var scheduleMsg string
+	if key := optString(optionMap(i.ApplicationCommandData().Options), "patient"); key != "" {
+		patient, err := resolvePatient(schedule, i.GuildID, key)
+		if err != nil {
+			respondError(s, i, err)
+			return
+		}
+		scheduleMsg = common.GetAllActiveMedications(patient)
+	} else {
+		patients := schedule.GuildPatients(i.GuildID)
+		parts := make([]string, 0, len(patients))
+		for _, patient := range patients {
+			parts = append(parts, common.GetAllActiveMedications(patient))
+		}
+		scheduleMsg = strings.Join(parts, "\n")
+		if scheduleMsg == "" {
+			scheduleMsg = "No patients have been set up yet."
+		}
+	}
 
-	// Respond with the schedule
-	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+	// Respond with the schedule, in follow-ups when it's longer than one message allows
+	chunks := splitMessage(scheduleMsg, maxMessageLength)
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseChannelMessageWithSource,
 		Data: &discordgo.InteractionResponseData{
-			Content: scheduleMsg,
+			Content: chunks[0],
 			Flags:   discordgo.MessageFlagsEphemeral,
 		},
 	})
+	if err != nil {
+		fmt.Printf("Error responding to /schedule: %v\n", err)
+		return
+	}
+	for _, chunk := range chunks[1:] {
+		_, err := s.FollowupMessageCreate(i.Interaction, true, &discordgo.WebhookParams{
+			Content: chunk,
+			Flags:   discordgo.MessageFlagsEphemeral,
+		})
+		if err != nil {
+			fmt.Printf("Error sending the rest of /schedule: %v\n", err)
+			return
+		}
+	}
 }
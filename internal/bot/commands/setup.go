@@ -0,0 +1,251 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/Sush1sui/meds_reminder/internal/common"
+	"github.com/bwmarrin/discordgo"
+)
+
+// Custom ID prefixes of the /setup modal and the components of its second step
+const (
+	SetupModalPrefix     = "setup"
+	SetupComponentPrefix = "setupstep"
+)
+
+// setupMaxReminded caps how many Discord users one patient's reminders go to
+const setupMaxReminded = 10
+
+// setupDrafts are patients waiting for the reminded users to be picked and Create or Cancel
+var setupDrafts = newDrafts[common.Patient]()
+
+// SetupCommand starts the wizard that creates a patient, the first thing a new guild does.
+// Patients belong to the guild that set them up, other guilds don't see them.
+func SetupCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	schedule, err := common.LoadMedicationState()
+	if err != nil {
+		respondEphemeral(s, i, "Error loading medication schedule: "+err.Error())
+		return
+	}
+
+	title := "Set up your first patient"
+	if len(schedule.GuildPatients(i.GuildID)) > 0 {
+		title = "Add a patient"
+	}
+	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseModal,
+		Data: &discordgo.InteractionResponseData{
+			CustomID: SetupModalPrefix,
+			Title:    title,
+			Components: []discordgo.MessageComponent{
+				textInputRow("name", "Name of the person or pet", "e.g. Diluc", discordgo.TextInputShort, true),
+				textInputRow("id", "Short ID used in commands (optional)", "From the name when empty, e.g. diluc", discordgo.TextInputShort, false),
+				textInputRow("timezone", "Timezone (optional)", "Default: "+common.DefaultLocation.String(), discordgo.TextInputShort, false),
+				textInputRow("greeting", "Reminder greeting (optional)", "It's time for {name}'s meds! 💊✨", discordgo.TextInputParagraph, false),
+			},
+		},
+	})
+}
+
+// SetupModalHandler checks the submitted patient and asks who should get the reminders
+func SetupModalHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	values := modalValues(i.ModalSubmitData())
+
+	schedule, err := common.LoadMedicationState()
+	if err != nil {
+		respondEphemeral(s, i, "Error loading medication schedule: "+err.Error())
+		return
+	}
+
+	patient, err := buildPatient(schedule, i.GuildID, values["name"], values["id"], values["timezone"], values["greeting"])
+	if err != nil {
+		respondEphemeral(s, i, "❌ "+errorText(err)+" Please run /setup again.")
+		return
+	}
+	if user := interactionUser(i); user != nil {
+		patient.DiscordIDs = []string{user.ID}
+	}
+
+	draftID := setupDrafts.store(patient)
+	minUsers := 1
+	defaults := make([]discordgo.SelectMenuDefaultValue, 0, len(patient.DiscordIDs))
+	for _, id := range patient.DiscordIDs {
+		defaults = append(defaults, discordgo.SelectMenuDefaultValue{ID: id, Type: discordgo.SelectMenuDefaultValueUser})
+	}
+
+	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: "Almost done! Who should get the reminders? Then create the patient:",
+			Embeds:  []*discordgo.MessageEmbed{patientEmbed(patient)},
+			Components: []discordgo.MessageComponent{
+				discordgo.ActionsRow{
+					Components: []discordgo.MessageComponent{
+						discordgo.SelectMenu{
+							MenuType:      discordgo.UserSelectMenu,
+							CustomID:      SetupComponentPrefix + ":users:" + draftID,
+							Placeholder:   "Who gets the reminders?",
+							MinValues:     &minUsers,
+							MaxValues:     setupMaxReminded,
+							DefaultValues: defaults,
+						},
+					},
+				},
+				discordgo.ActionsRow{
+					Components: []discordgo.MessageComponent{
+						discordgo.Button{
+							Label:    "Create patient",
+							Style:    discordgo.SuccessButton,
+							CustomID: SetupComponentPrefix + ":create:" + draftID,
+						},
+						discordgo.Button{
+							Label:    "Cancel",
+							Style:    discordgo.SecondaryButton,
+							CustomID: SetupComponentPrefix + ":cancel:" + draftID,
+						},
+					},
+				},
+			},
+			Flags: discordgo.MessageFlagsEphemeral,
+		},
+	})
+}
+
+// SetupComponentHandler handles the reminded users picker and the Create and Cancel buttons
+func SetupComponentHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	// Custom ID format: setupstep:<users|create|cancel>:<draftID>
+	data := i.MessageComponentData()
+	parts := strings.SplitN(data.CustomID, ":", 3)
+	if len(parts) != 3 {
+		respondEphemeral(s, i, "Unknown button.")
+		return
+	}
+
+	if parts[1] == "users" {
+		if !setupDrafts.update(parts[2], func(patient *common.Patient) { patient.DiscordIDs = data.Values }) {
+			updateMessage(s, i, "⌛ This setup has expired. Please run /setup again.", nil)
+			return
+		}
+		// The picker already shows the new choice, nothing else on the message changes
+		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{Type: discordgo.InteractionResponseDeferredMessageUpdate})
+		return
+	}
+
+	patient, ok := setupDrafts.take(parts[2])
+	if !ok {
+		updateMessage(s, i, "⌛ This setup has expired. Please run /setup again.", nil)
+		return
+	}
+	if parts[1] != "create" {
+		updateMessage(s, i, "Cancelled, no patient was created.", nil)
+		return
+	}
+
+	err := common.UpdateMedicationState(func(schedule *common.MedicationSchedule) error {
+		// Someone else may have added the same patient while this one was drafted
+		if err := patientConflict(schedule, patient); err != nil {
+			return fmt.Errorf("%w, please run /setup again with another name or ID", err)
+		}
+		schedule.Patients = append(schedule.Patients, patient)
+		return nil
+	})
+	if err != nil {
+		updateMessage(s, i, "❌ "+errorText(err), nil)
+		return
+	}
+
+	updateMessage(s, i, fmt.Sprintf("✅ **%s** is set up! Next, add their first medication with `/med new patient:%s`, then check it with `/schedule`.", patient.Name, patient.ID),
+		[]*discordgo.MessageEmbed{patientEmbed(patient)})
+}
+
+// buildPatient checks a new patient of a guild, making an ID from the name when none was given
+func buildPatient(schedule *common.MedicationSchedule, guildID, name, id, zone, greeting string) (common.Patient, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return common.Patient{}, fmt.Errorf("a name is required")
+	}
+	id = patientID(id)
+	if id == "" {
+		id = patientID(name)
+	}
+	if id == "" {
+		return common.Patient{}, fmt.Errorf("please give an ID made of letters or numbers")
+	}
+
+	patient := common.Patient{
+		ID:              id,
+		Name:            name,
+		GuildID:         guildID,
+		Medications:     []common.Medication{},
+		MessageTemplate: strings.TrimSpace(greeting),
+	}
+	if zone = strings.TrimSpace(zone); zone != "" {
+		loc, err := common.LoadTimezone(zone)
+		if err != nil {
+			return common.Patient{}, err
+		}
+		patient.Timezone = loc.String()
+	}
+	if err := patientConflict(schedule, patient); err != nil {
+		return common.Patient{}, err
+	}
+	return patient, nil
+}
+
+// patientConflict reports whether a new patient's ID is taken, or its guild already has a
+// patient by that name. IDs are shared by all guilds, but the patients of other guilds
+// aren't named.
+func patientConflict(schedule *common.MedicationSchedule, patient common.Patient) error {
+	for _, existing := range schedule.Patients {
+		sameGuild := existing.InGuild(patient.GuildID)
+		switch {
+		case strings.EqualFold(existing.ID, patient.ID) && !sameGuild:
+			return fmt.Errorf("the ID %q is already taken, please give another one", patient.ID)
+		case sameGuild && (strings.EqualFold(existing.ID, patient.ID) || strings.EqualFold(existing.Name, patient.Name)):
+			return fmt.Errorf("there is already a patient called %s (%s)", existing.Name, existing.ID)
+		}
+	}
+	return nil
+}
+
+// patientID turns text into a lowercase command key, e.g. "Mr. Whiskers" into "mr-whiskers"
+func patientID(text string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(strings.TrimSpace(text)) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return b.String()
+}
+
+// patientEmbed shows a patient's details for review
+func patientEmbed(patient common.Patient) *discordgo.MessageEmbed {
+	reminded := make([]string, 0, len(patient.DiscordIDs))
+	for _, id := range patient.DiscordIDs {
+		reminded = append(reminded, "<@"+id+">")
+	}
+	if len(reminded) == 0 {
+		reminded = append(reminded, "Nobody yet")
+	}
+
+	return &discordgo.MessageEmbed{
+		Title: "🧑 " + patient.Name,
+		Color: 0x57F287,
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "ID", Value: patient.ID, Inline: true},
+			{Name: "Timezone", Value: patient.Location().String(), Inline: true},
+			{Name: "Reminded", Value: strings.Join(reminded, ", "), Inline: true},
+			{Name: "Greeting", Value: patient.Greeting()},
+		},
+	}
+}
@@ -0,0 +1,141 @@
+package commands
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Sush1sui/meds_reminder/internal/common"
+	"github.com/bwmarrin/discordgo"
+)
+
+// maxSnooze keeps a snooze from silently swallowing the next scheduled dose
+const maxSnooze = 12 * time.Hour
+
+// SnoozeButtonHandler snoozes a reminder for the duration picked under the message
+func SnoozeButtonHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	// Custom ID format: snooze:<minutes|back>:<reminderID>
+	parts := strings.SplitN(i.MessageComponentData().CustomID, ":", 3)
+	if len(parts) != 3 {
+		respondEphemeral(s, i, "Unknown button.")
+		return
+	}
+	reminderID := parts[2]
+
+	// Back restores the original dose buttons
+	if parts[1] == "back" {
+		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseUpdateMessage,
+			Data: &discordgo.InteractionResponseData{
+				Content:    i.Message.Content,
+				Components: common.ReminderComponents(reminderID),
+			},
+		})
+		return
+	}
+
+	minutes, err := strconv.Atoi(parts[1])
+	if err != nil || minutes <= 0 {
+		respondEphemeral(s, i, "Unknown snooze duration.")
+		return
+	}
+
+	user := interactionUser(i)
+	if user == nil {
+		return
+	}
+
+	now := time.Now()
+	until := now.Add(time.Duration(minutes) * time.Minute)
+	updated, err := common.SnoozeReminder(reminderID, until, user.ID, now)
+	if err != nil {
+		respondEphemeral(s, i, "Error snoozing reminder: "+err.Error())
+		return
+	}
+	if len(updated) == 0 {
+		respondEphemeral(s, i, "This reminder was already handled.")
+		return
+	}
+
+	content := i.Message.Content + "\n\n" + snoozeLine(user.ID, now, until)
+	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content:    content,
+			Components: []discordgo.MessageComponent{},
+		},
+	})
+}
+
+// SnoozeCommand snoozes the latest open dose of a medication
+func SnoozeCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	opts := optionMap(i.ApplicationCommandData().Options)
+
+	name := optString(opts, "medication")
+	if name == "" {
+		respondEphemeral(s, i, "Please choose a medication to snooze.")
+		return
+	}
+
+	duration := 10 * time.Minute
+	if opt, ok := opts["minutes"]; ok {
+		duration = time.Duration(opt.IntValue()) * time.Minute
+	}
+	if opt, ok := opts["custom"]; ok {
+		d, err := parseSnoozeDuration(opt.StringValue())
+		if err != nil {
+			respondError(s, i, err)
+			return
+		}
+		duration = d
+	}
+
+	user := interactionUser(i)
+	if user == nil {
+		return
+	}
+
+	schedule, err := common.LoadMedicationState()
+	if err != nil {
+		respondEphemeral(s, i, "Error loading medication schedule: "+err.Error())
+		return
+	}
+	patient, med, err := findPatientMedication(schedule, i.GuildID, optString(opts, "patient"), name)
+	if err != nil {
+		respondError(s, i, err)
+		return
+	}
+
+	now := time.Now()
+	until := now.Add(duration)
+	if _, err := common.SnoozeMedication(patient.ID, med.Name, until, user.ID, now); err != nil {
+		respondEphemeral(s, i, "Could not snooze: "+err.Error())
+		return
+	}
+
+	respondEphemeral(s, i, fmt.Sprintf("💤 %s's **%s** snoozed — reminding again at %s.", patient.Name, med.Name, until.In(patient.LocationAt(until)).Format("15:04")))
+}
+
+// parseSnoozeDuration accepts plain minutes ("45") or a Go duration ("1h30m")
+func parseSnoozeDuration(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+
+	var d time.Duration
+	if minutes, err := strconv.Atoi(value); err == nil {
+		d = time.Duration(minutes) * time.Minute
+	} else if d, err = time.ParseDuration(value); err != nil {
+		return 0, fmt.Errorf("invalid duration %q, use minutes like 45 or a duration like 1h30m", value)
+	}
+
+	if d <= 0 || d > maxSnooze {
+		return 0, fmt.Errorf("snooze must be between 1 minute and %d hours", int(maxSnooze.Hours()))
+	}
+	return d, nil
+}
+
+// snoozeLine describes who snoozed a reminder and until when, in each reader's own timezone
+func snoozeLine(userID string, at, until time.Time) string {
+	return fmt.Sprintf("💤 **Snoozed** by <@%s> at <t:%d:f> — reminding again at <t:%d:t>",
+		userID, at.Unix(), until.Unix())
+}
@@ -0,0 +1,143 @@
+package commands
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Sush1sui/meds_reminder/internal/common"
+	"github.com/bwmarrin/discordgo"
+)
+
+// StockCommand routes the /stock subcommands that track medication supplies
+func StockCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	data := i.ApplicationCommandData()
+	if len(data.Options) == 0 {
+		respondEphemeral(s, i, "Please choose a /stock subcommand.")
+		return
+	}
+
+	sub := data.Options[0]
+	opts := optionMap(sub.Options)
+
+	switch sub.Name {
+	case "view":
+		stockView(s, i, opts)
+	case "set":
+		stockSet(s, i, opts)
+	default:
+		respondEphemeral(s, i, "Unknown /stock subcommand.")
+	}
+}
+
+// stockView lists the supply of one medication, or of every tracked medication of a patient
+func stockView(s *discordgo.Session, i *discordgo.InteractionCreate, opts map[string]*discordgo.ApplicationCommandInteractionDataOption) {
+	schedule, err := common.LoadMedicationState()
+	if err != nil {
+		respondEphemeral(s, i, "Error loading medication schedule: "+err.Error())
+		return
+	}
+	doseLog, err := common.LoadDoseLog()
+	if err != nil {
+		respondEphemeral(s, i, "Error loading dose log: "+err.Error())
+		return
+	}
+
+	var patient *common.Patient
+	var meds []common.Medication
+	if name := optString(opts, "medication"); name != "" {
+		p, med, err := findPatientMedication(schedule, i.GuildID, optString(opts, "patient"), name)
+		if err != nil {
+			respondError(s, i, err)
+			return
+		}
+		if med.Stock == nil {
+			respondEphemeral(s, i, fmt.Sprintf("No supply is recorded for **%s**. Use `/stock set` to add one.", med.Name))
+			return
+		}
+		patient, meds = p, []common.Medication{*med}
+	} else {
+		patient, err = resolvePatient(schedule, i.GuildID, optString(opts, "patient"))
+		if err != nil {
+			respondError(s, i, err)
+			return
+		}
+		for _, med := range patient.Medications {
+			if med.Active && med.Stock != nil {
+				meds = append(meds, med)
+			}
+		}
+		if len(meds) == 0 {
+			respondEphemeral(s, i, fmt.Sprintf("No supplies are recorded for %s. Use `/stock set` to add one.", patient.Name))
+			return
+		}
+	}
+
+	now := time.Now()
+	msg := fmt.Sprintf("📦 **Supplies — %s** 📦\n\n", patient.Name)
+	for _, med := range meds {
+		status := med.StockStatus(patient.ID, doseLog, now, patient.LocationAt)
+		msg += fmt.Sprintf("💊 **%s**\n", med.Name)
+		msg += fmt.Sprintf("   %s\n", common.FormatStock(med, status, patient.LocationAt))
+		msg += fmt.Sprintf("   🧴 Counted %s, alert below %d days\n\n", med.Stock.Since.In(patient.LocationAt(med.Stock.Since)).Format("Jan 2 15:04"), med.Stock.RefillAlertDays())
+	}
+	respondEphemeral(s, i, msg)
+}
+
+// stockSet records a new supply of a medication, e.g. a fresh 120 ml bottle
+func stockSet(s *discordgo.Session, i *discordgo.InteractionCreate, opts map[string]*discordgo.ApplicationCommandInteractionDataOption) {
+	amount, err := common.ParseDose(optString(opts, "amount"))
+	if err != nil {
+		respondError(s, i, err)
+		return
+	}
+
+	var patient *common.Patient
+	var med *common.Medication
+	var stock *common.Stock
+	ok := updateSchedule(s, i, func(schedule *common.MedicationSchedule) error {
+		var err error
+		patient, med, err = findPatientMedication(schedule, i.GuildID, optString(opts, "patient"), optString(opts, "medication"))
+		if err != nil {
+			return err
+		}
+
+		// Without a per-dose amount, the medication's dose is used when it's in the same unit
+		perDose := med.Dose
+		if text := optString(opts, "per_dose"); text != "" {
+			perDose, err = common.ParseDose(text)
+			if err != nil {
+				return err
+			}
+		}
+		if !perDose.Structured() || perDose.Unit != amount.Unit {
+			return fmt.Errorf("couldn't tell how much of the %s supply each dose of **%s** (%s) uses, please pass per_dose, e.g. 4 ml", amount.Unit, med.Name, med.Dose)
+		}
+
+		stock = &common.Stock{
+			Amount:  amount.Amount,
+			Unit:    string(amount.Unit),
+			PerDose: perDose.Amount,
+			Since:   time.Now(),
+		}
+		if med.Stock != nil {
+			stock.AlertDays = med.Stock.AlertDays
+		}
+		if opt, ok := opts["alert_days"]; ok {
+			stock.AlertDays = int(opt.IntValue())
+		}
+		med.Stock = stock
+		return nil
+	})
+	if !ok {
+		return
+	}
+
+	doseLog, err := common.LoadDoseLog()
+	if err != nil {
+		fmt.Printf("Error loading dose log: %v\n", err)
+	}
+	status := med.StockStatus(patient.ID, doseLog, time.Now(), patient.LocationAt)
+	respondEphemeral(s, i, fmt.Sprintf("📦 Recorded %s of **%s** for %s: %s. A refill alert goes out below %d days of supply.",
+		amount, med.Name, patient.Name, common.FormatStock(*med, status, patient.LocationAt), stock.RefillAlertDays()))
+	common.CheckStock(s, patient.ID)
+}
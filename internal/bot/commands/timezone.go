@@ -0,0 +1,110 @@
+package commands
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/Sush1sui/meds_reminder/internal/common"
+	"github.com/bwmarrin/discordgo"
+)
+
+// commonTimezones are offered by autocomplete; any other IANA name can still be typed in full
+var commonTimezones = []string{
+	"Asia/Manila", "Asia/Singapore", "Asia/Hong_Kong", "Asia/Shanghai", "Asia/Taipei",
+	"Asia/Tokyo", "Asia/Seoul", "Asia/Jakarta", "Asia/Bangkok", "Asia/Ho_Chi_Minh",
+	"Asia/Kolkata", "Asia/Dubai", "Asia/Riyadh", "Asia/Karachi", "Asia/Dhaka",
+	"Australia/Sydney", "Australia/Melbourne", "Australia/Brisbane", "Australia/Perth",
+	"Pacific/Auckland", "Pacific/Honolulu", "Pacific/Guam",
+	"Europe/London", "Europe/Dublin", "Europe/Lisbon", "Europe/Paris", "Europe/Berlin",
+	"Europe/Madrid", "Europe/Rome", "Europe/Amsterdam", "Europe/Zurich", "Europe/Stockholm",
+	"Europe/Warsaw", "Europe/Athens", "Europe/Istanbul", "Europe/Moscow",
+	"Africa/Cairo", "Africa/Johannesburg", "Africa/Lagos", "Africa/Nairobi",
+	"America/New_York", "America/Chicago", "America/Denver", "America/Phoenix",
+	"America/Los_Angeles", "America/Anchorage", "America/Toronto", "America/Vancouver",
+	"America/Mexico_City", "America/Sao_Paulo", "America/Buenos_Aires", "America/Bogota",
+	"America/Lima", "America/Santiago",
+	"UTC",
+}
+
+// TimezoneCommand shows or changes the timezone a patient's medication times are in
+func TimezoneCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	opts := optionMap(i.ApplicationCommandData().Options)
+
+	zone := optString(opts, "zone")
+	if zone == "" {
+		schedule, err := common.LoadMedicationState()
+		if err != nil {
+			respondEphemeral(s, i, "Error loading medication schedule: "+err.Error())
+			return
+		}
+		patient, err := resolvePatient(schedule, i.GuildID, optString(opts, "patient"))
+		if err != nil {
+			respondError(s, i, err)
+			return
+		}
+		loc := patient.Location()
+		respondEphemeral(s, i, fmt.Sprintf("🌍 %s's medication times are in **%s** (now %s).", patient.Name, loc, time.Now().In(loc).Format("Mon 15:04 MST")))
+		return
+	}
+
+	loc, err := common.LoadTimezone(zone)
+	if err != nil {
+		respondError(s, i, err)
+		return
+	}
+
+	var patient *common.Patient
+	var previous *time.Location
+	var cancelled bool
+	ok := updateSchedule(s, i, func(schedule *common.MedicationSchedule) error {
+		var err error
+		patient, err = resolvePatient(schedule, i.GuildID, optString(opts, "patient"))
+		if err != nil {
+			return err
+		}
+
+		previous = patient.Location()
+		patient.Timezone = loc.String()
+		// Picking a timezone by hand replaces a gradual move
+		cancelled = patient.Travel != nil
+		patient.Travel = nil
+		return nil
+	})
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	msg := fmt.Sprintf("🌍 %s's medication times are now in **%s** (now %s, was %s in %s). Dose times keep their clock times, so 08:00 means 08:00 in the new timezone.",
+		patient.Name, loc, now.In(loc).Format("Mon 15:04 MST"), now.In(previous).Format("15:04"), previous)
+	if cancelled {
+		msg += "\n✈️ The travel plan was cancelled."
+	}
+	respondEphemeral(s, i, msg)
+}
+
+// timezoneChoices suggests common timezones matching the query
+func timezoneChoices(query string) []*discordgo.ApplicationCommandOptionChoice {
+	type scored struct {
+		score int
+		name  string
+	}
+
+	var matches []scored
+	for _, name := range commonTimezones {
+		if score := fuzzyScore(name, query); score > 0 {
+			matches = append(matches, scored{score, name})
+		}
+	}
+	sort.SliceStable(matches, func(a, b int) bool { return matches[a].score > matches[b].score })
+
+	choices := make([]*discordgo.ApplicationCommandOptionChoice, 0, len(matches))
+	for _, m := range matches {
+		if len(choices) == maxAutocompleteChoices {
+			break
+		}
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: m.name, Value: m.name})
+	}
+	return choices
+}
@@ -0,0 +1,78 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Sush1sui/meds_reminder/internal/common"
+	"github.com/bwmarrin/discordgo"
+)
+
+// TookCommand records a dose taken right now. As-needed medications are checked against
+// their spacing and daily cap, and a dose breaking them is refused unless forced.
+func TookCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	opts := optionMap(i.ApplicationCommandData().Options)
+
+	user := interactionUser(i)
+	if user == nil {
+		return
+	}
+
+	schedule, err := common.LoadMedicationState()
+	if err != nil {
+		respondEphemeral(s, i, "Error loading medication schedule: "+err.Error())
+		return
+	}
+	patient, med, err := findPatientMedication(schedule, i.GuildID, optString(opts, "patient"), optString(opts, "medication"))
+	if err != nil {
+		respondError(s, i, err)
+		return
+	}
+
+	force := false
+	if opt, ok := opts["force"]; ok {
+		force = opt.BoolValue()
+	}
+
+	now := time.Now()
+	recorded, check, nextAllowed, err := common.TakeDose(patient.ID, *med, user.ID, now, force)
+	if errors.Is(err, common.ErrNoOpenDose) {
+		respondEphemeral(s, i, fmt.Sprintf("ℹ️ No reminder of %s's **%s** is waiting to be confirmed. Doses at fixed times are recorded from their reminders.", patient.Name, med.Name))
+		return
+	}
+	if err != nil {
+		respondEphemeral(s, i, "Error recording dose: "+err.Error())
+		return
+	}
+
+	loc := patient.Location()
+	if !recorded {
+		respondEphemeral(s, i, fmt.Sprintf("⛔ Not recorded: %s\nThe next dose of **%s** is allowed at **%s**. Use `force: True` to record it anyway.",
+			prnViolation(*med.PRN, check, loc), med.Name, check.AllowedFrom.In(loc).Format("Jan 2 15:04")))
+		return
+	}
+
+	common.RefreshMedicationCounts()
+	common.CheckStock(s, patient.ID)
+
+	msg := fmt.Sprintf("✅ Recorded %s's **%s** (%s) at %s.", patient.Name, med.Name, med.Dose, now.In(loc).Format("15:04"))
+	if med.PRN != nil {
+		if !check.Allowed() {
+			msg = "⚠️ " + prnViolation(*med.PRN, check, loc) + "\n" + msg + " It was recorded anyway."
+		}
+		if med.PRN.MaxPer24h > 0 {
+			msg += fmt.Sprintf("\n📊 %d of %d doses in the last 24 hours.", check.TakenIn24h+1, med.PRN.MaxPer24h)
+		}
+		msg += fmt.Sprintf("\n⏭️ Next dose allowed from **%s**.", nextAllowed.In(loc).Format("Jan 2 15:04"))
+	}
+	respondEphemeral(s, i, msg)
+}
+
+// prnViolation explains which limit of an as-needed medication a dose breaks
+func prnViolation(rule common.PRNRule, check common.PRNCheck, loc *time.Location) string {
+	if check.OverCap {
+		return fmt.Sprintf("%d doses were already taken in the last 24 hours, the maximum is %d.", check.TakenIn24h, rule.MaxPer24h)
+	}
+	return fmt.Sprintf("the last dose was at %s, doses must be at least %dh apart.", check.LastTaken.In(loc).Format("15:04"), rule.MinHoursApart)
+}
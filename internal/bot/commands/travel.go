@@ -0,0 +1,105 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Sush1sui/meds_reminder/internal/common"
+	"github.com/bwmarrin/discordgo"
+)
+
+// TravelCommand routes the /travel subcommands that move a schedule to another timezone
+func TravelCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	data := i.ApplicationCommandData()
+	if len(data.Options) == 0 {
+		respondEphemeral(s, i, "Please choose a /travel subcommand.")
+		return
+	}
+
+	sub := data.Options[0]
+	opts := optionMap(sub.Options)
+
+	switch sub.Name {
+	case "start":
+		travelStart(s, i, opts)
+	case "cancel":
+		travelCancel(s, i, opts)
+	default:
+		respondEphemeral(s, i, "Unknown /travel subcommand.")
+	}
+}
+
+// travelStart plans a gradual move to the destination timezone and previews it
+func travelStart(s *discordgo.Session, i *discordgo.InteractionCreate, opts map[string]*discordgo.ApplicationCommandInteractionDataOption) {
+	var patient *common.Patient
+	var destination *time.Location
+	ok := updateSchedule(s, i, func(schedule *common.MedicationSchedule) error {
+		var err error
+		patient, err = resolvePatient(schedule, i.GuildID, optString(opts, "patient"))
+		if err != nil {
+			return err
+		}
+		if patient.Travel != nil {
+			return fmt.Errorf("%s already has a travel plan to %s, use `/travel cancel` first", patient.Name, patient.Travel.Destination)
+		}
+
+		destination, err = common.LoadTimezone(optString(opts, "zone"))
+		if err != nil {
+			return err
+		}
+
+		origin := patient.Location()
+		departure, err := time.ParseInLocation("2006-01-02", optString(opts, "departure"), origin)
+		if err != nil {
+			return errors.New("invalid departure date, expected YYYY-MM-DD")
+		}
+		now := time.Now().In(origin)
+		if departure.Before(time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, origin)) {
+			return errors.New("the departure date is in the past")
+		}
+
+		hours := 0
+		if opt, ok := opts["hours_per_day"]; ok {
+			hours = int(opt.IntValue())
+		}
+
+		plan, err := common.NewTravelPlan(origin, destination, departure, hours)
+		if err != nil {
+			return err
+		}
+		patient.Travel = plan
+		return nil
+	})
+	if !ok {
+		return
+	}
+
+	respondEphemeral(s, i, fmt.Sprintf("✅ Planned %s's move to %s. The times shift each day at midnight and the plan shows in `/schedule` until it's done.\n\n%s",
+		patient.Name, destination, common.FormatTravelPlan(patient)))
+}
+
+// travelCancel drops a patient's travel plan, leaving the schedule in the origin timezone
+func travelCancel(s *discordgo.Session, i *discordgo.InteractionCreate, opts map[string]*discordgo.ApplicationCommandInteractionDataOption) {
+	var patient *common.Patient
+	var origin string
+	ok := updateSchedule(s, i, func(schedule *common.MedicationSchedule) error {
+		var err error
+		patient, err = resolvePatient(schedule, i.GuildID, optString(opts, "patient"))
+		if err != nil {
+			return err
+		}
+		if patient.Travel == nil {
+			return fmt.Errorf("%s has no travel plan", patient.Name)
+		}
+
+		origin = patient.Travel.Origin
+		patient.Travel = nil
+		return nil
+	})
+	if !ok {
+		return
+	}
+
+	respondEphemeral(s, i, fmt.Sprintf("🗑️ Cancelled %s's travel plan, the times are back in %s. Use `/timezone` to switch straight to another timezone.", patient.Name, origin))
+}
@@ -0,0 +1,109 @@
+package commands
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/Sush1sui/meds_reminder/internal/common"
+	"github.com/bwmarrin/discordgo"
+)
+
+// weightHistoryShown is how many of the latest weighings /weight lists
+const weightHistoryShown = 10
+
+// WeightCommand records a patient's weight and recomputes doses prescribed in mg/kg, or
+// shows the weight history when no weight is given
+func WeightCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	data := i.ApplicationCommandData()
+	opts := optionMap(data.Options)
+
+	opt, ok := opts["kg"]
+	if !ok {
+		schedule, err := common.LoadMedicationState()
+		if err != nil {
+			respondEphemeral(s, i, "Error loading medication schedule: "+err.Error())
+			return
+		}
+		patient, err := resolvePatient(schedule, i.GuildID, optString(opts, "patient"))
+		if err != nil {
+			respondError(s, i, err)
+			return
+		}
+		respondEphemeral(s, i, describeWeights(patient))
+		return
+	}
+
+	doseLog, err := common.LoadDoseLog()
+	if err != nil {
+		fmt.Printf("Error loading dose log: %v\n", err)
+	}
+
+	var patient *common.Patient
+	var changes []common.DoseChange
+	ok = updateSchedule(s, i, func(schedule *common.MedicationSchedule) error {
+		var err error
+		patient, err = resolvePatient(schedule, i.GuildID, optString(opts, "patient"))
+		if err != nil {
+			return err
+		}
+		changes, err = common.RecordWeight(patient, opt.FloatValue(), time.Now(), doseLog)
+		return err
+	})
+	if !ok {
+		return
+	}
+
+	msg := fmt.Sprintf("⚖️ Recorded %s kg for %s.", formatKg(opt.FloatValue()), patient.Name)
+	if warning := common.FormatDoseChanges(changes); warning != "" {
+		msg += "\n\n" + warning
+	}
+	respondEphemeral(s, i, msg+"\n\n"+describeWeights(patient))
+}
+
+// describeWeights lists a patient's latest weighings and the doses computed from them
+func describeWeights(patient *common.Patient) string {
+	if len(patient.Weights) == 0 {
+		return fmt.Sprintf("No weight is recorded for %s yet. Record one with `/weight kg:`.", patient.Name)
+	}
+
+	loc := patient.Location()
+	msg := fmt.Sprintf("⚖️ **Weight — %s** ⚖️\n\n", patient.Name)
+	first := max(len(patient.Weights)-weightHistoryShown, 0)
+	for idx := len(patient.Weights) - 1; idx >= first; idx-- {
+		w := patient.Weights[idx]
+		line := fmt.Sprintf("   %s kg on %s", formatKg(w.Kg), w.At.In(loc).Format("Jan 2, 2006"))
+		if idx > 0 {
+			if diff := w.Kg - patient.Weights[idx-1].Kg; diff != 0 {
+				line += fmt.Sprintf(" (%+g kg)", roundKg(diff))
+			}
+		}
+		msg += line + "\n"
+	}
+
+	var doses string
+	for _, med := range patient.Medications {
+		if !med.Active || med.MgPerKg <= 0 {
+			continue
+		}
+		doses += fmt.Sprintf("💊 **%s**: %s\n", med.Name, med.Dose)
+		if basis := med.WeightBasis(patient); basis != "" {
+			doses += fmt.Sprintf("   ⚖️ By weight: %s\n", basis)
+		}
+	}
+	if doses != "" {
+		msg += "\n" + doses
+	}
+	return msg
+}
+
+// roundKg rounds a weight to the 10 g a scale shows
+func roundKg(kg float64) float64 {
+	return math.Round(kg*100) / 100
+}
+
+// formatKg renders a weight without trailing zeros, e.g. "22.5"
+func formatKg(kg float64) string {
+	return strconv.FormatFloat(roundKg(kg), 'f', -1, 64)
+}
@@ -3,8 +3,10 @@ package deploy
 import (
 	"fmt"
 	"log"
+	"strings"
 
 	"github.com/Sush1sui/meds_reminder/internal/bot/commands"
+	"github.com/Sush1sui/meds_reminder/internal/common"
 	"github.com/bwmarrin/discordgo"
 )
 
@@ -14,19 +16,25 @@ var SlashCommands = []*discordgo.ApplicationCommand{
 		Name:        "remind",
 		Description: "Send medication reminders to users",
 		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:         discordgo.ApplicationCommandOptionString,
+				Name:         "patient",
+				Description:  "Patient ID or name to remind",
+				Required:     true,
+				Autocomplete: true,
+			},
 			{
 				Type:        discordgo.ApplicationCommandOptionString,
-				Name:        "user",
-				Description: "Choose who to remind",
-				Required:    true,
+				Name:        "kind",
+				Description: "Which reminder to send",
 				Choices: []*discordgo.ApplicationCommandOptionChoice{
 					{
-						Name:  "JP (Medication Schedule)",
-						Value: "jp",
+						Name:  "Medication Schedule",
+						Value: "medications",
 					},
 					{
-						Name:  "Dane (Simple Reminder)",
-						Value: "dane",
+						Name:  "Simple Reminder",
+						Value: "simple",
 					},
 				},
 			},
@@ -35,56 +43,665 @@ var SlashCommands = []*discordgo.ApplicationCommand{
 	{
 		Name:        "schedule",
 		Description: "View current medication schedule and remaining days",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:         discordgo.ApplicationCommandOptionString,
+				Name:         "patient",
+				Description:  "Patient ID or name (default: everyone)",
+				Autocomplete: true,
+			},
+		},
+	},
+	{
+		Name:        "snooze",
+		Description: "Remind about a medication again later",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:         discordgo.ApplicationCommandOptionString,
+				Name:         "medication",
+				Description:  "Medication to snooze",
+				Required:     true,
+				Autocomplete: true,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionInteger,
+				Name:        "minutes",
+				Description: "How long to snooze (default 10 minutes)",
+				Choices: []*discordgo.ApplicationCommandOptionChoice{
+					{Name: "5 minutes", Value: 5},
+					{Name: "10 minutes", Value: 10},
+					{Name: "30 minutes", Value: 30},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "custom",
+				Description: "Custom duration, e.g. 45 or 1h30m",
+			},
+			{
+				Type:         discordgo.ApplicationCommandOptionString,
+				Name:         "patient",
+				Description:  "Patient ID or name, if several take this medication",
+				Autocomplete: true,
+			},
+		},
+	},
+	{
+		Name:        "med",
+		Description: "Add, edit, taper or remove a patient's medications",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "add",
+				Description: "Add a medication",
+				Options: []*discordgo.ApplicationCommandOption{
+					medNameOption("Medication name", false),
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "dose",
+						Description: "Dose per reminder, e.g. 2 ml or 1/2 tab",
+						Required:    true,
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "times",
+						Description: "24h times like 08:00, 20:00, an interval like every 8h, or as needed",
+						Required:    true,
+					},
+					medPatientOption(),
+					medDaysOption(),
+					medDosesOption(),
+					medStartOption(),
+					medIndicationOption(),
+					medNotesOption(),
+					medSpacingOption(),
+					medMaxDailyOption(),
+					medRepeatOption(),
+					medMgPerKgOption(),
+					medConcentrationOption(),
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "new",
+				Description: "Add a medication using a form",
+				Options: []*discordgo.ApplicationCommandOption{
+					medPatientOption(),
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "edit",
+				Description: "Change an existing medication",
+				Options: []*discordgo.ApplicationCommandOption{
+					medNameOption("Medication to edit", true),
+					medPatientOption(),
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "dose",
+						Description: "New dose per reminder",
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "times",
+						Description: "New 24h times, an interval like every 8h, or as needed",
+					},
+					medDaysOption(),
+					medDosesOption(),
+					medStartOption(),
+					medIndicationOption(),
+					medNotesOption(),
+					medSpacingOption(),
+					medMaxDailyOption(),
+					medRepeatOption(),
+					medMgPerKgOption(),
+					medConcentrationOption(),
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "remove",
+				Description: "Remove a medication",
+				Options: []*discordgo.ApplicationCommandOption{
+					medNameOption("Medication to remove", true),
+					medPatientOption(),
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "escalation",
+				Description: "Show or set who is told when a dose goes unconfirmed",
+				Options: []*discordgo.ApplicationCommandOption{
+					medNameOption("Medication to escalate", true),
+					{
+						Type:        discordgo.ApplicationCommandOptionInteger,
+						Name:        "remind_after",
+						Description: "Minutes after the reminder to remind the patient again, 0 to stop",
+						MinValue:    &minEscalationMinutes,
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionInteger,
+						Name:        "caregiver_after",
+						Description: "Minutes after the reminder to tell the caregivers, 0 to stop",
+						MinValue:    &minEscalationMinutes,
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "caregivers",
+						Description: "Caregivers to DM, as mentions or user IDs (none to clear)",
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionBoolean,
+						Name:        "email",
+						Description: "Also email the patient's email addresses with the caregivers",
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionInteger,
+						Name:        "channel_after",
+						Description: "Minutes after the reminder to post in the channel, 0 to stop",
+						MinValue:    &minEscalationMinutes,
+					},
+					{
+						Type:         discordgo.ApplicationCommandOptionChannel,
+						Name:         "channel",
+						Description:  "Channel to post unconfirmed doses in",
+						ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText},
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionBoolean,
+						Name:        "off",
+						Description: "Stop escalating this medication's doses",
+					},
+					medPatientOption(),
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommandGroup,
+				Name:        "phase",
+				Description: "Build a tapering or phased regimen",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Name:        "add",
+						Description: "Add a phase with its own times and dose",
+						Options: []*discordgo.ApplicationCommandOption{
+							medNameOption("Medication to taper", true),
+							{
+								Type:        discordgo.ApplicationCommandOptionInteger,
+								Name:        "from",
+								Description: "First day of the phase, the start date being day 1",
+								Required:    true,
+								MinValue:    &minPhaseDay,
+							},
+							{
+								Type:        discordgo.ApplicationCommandOptionString,
+								Name:        "times",
+								Description: "Comma separated 24h times during this phase",
+								Required:    true,
+							},
+							{
+								Type:        discordgo.ApplicationCommandOptionInteger,
+								Name:        "to",
+								Description: "Last day of the phase (default: until the course ends)",
+								MinValue:    &minPhaseDay,
+							},
+							{
+								Type:        discordgo.ApplicationCommandOptionString,
+								Name:        "dose",
+								Description: "Dose during this phase (default: the medication's dose)",
+							},
+							{
+								Type:        discordgo.ApplicationCommandOptionString,
+								Name:        "notes",
+								Description: "Instructions during this phase",
+							},
+							medPatientOption(),
+						},
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Name:        "clear",
+						Description: "Remove every phase of a medication",
+						Options: []*discordgo.ApplicationCommandOption{
+							medNameOption("Medication to stop tapering", true),
+							medPatientOption(),
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        "took",
+		Description: "Record a dose taken just now, checking as-needed limits",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:         discordgo.ApplicationCommandOptionString,
+				Name:         "medication",
+				Description:  "Medication that was taken",
+				Required:     true,
+				Autocomplete: true,
+			},
+			{
+				Type:         discordgo.ApplicationCommandOptionString,
+				Name:         "patient",
+				Description:  "Patient ID or name, if several take this medication",
+				Autocomplete: true,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionBoolean,
+				Name:        "force",
+				Description: "Record the dose even if it breaks the spacing or daily limit",
+			},
+		},
+	},
+	{
+		Name:        "timezone",
+		Description: "Show or change the timezone a patient's medication times are in",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:         discordgo.ApplicationCommandOptionString,
+				Name:         "zone",
+				Description:  "IANA timezone, e.g. Asia/Manila or Europe/Berlin (default: show the current one)",
+				Autocomplete: true,
+			},
+			medPatientOption(),
+		},
+	},
+	{
+		Name:        "travel",
+		Description: "Move a patient's schedule to another timezone a little each day",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "start",
+				Description: "Plan the move and preview it day by day",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:         discordgo.ApplicationCommandOptionString,
+						Name:         "zone",
+						Description:  "Destination IANA timezone, e.g. Europe/Berlin",
+						Required:     true,
+						Autocomplete: true,
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "departure",
+						Description: "Departure date YYYY-MM-DD, the first day the times move",
+						Required:    true,
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionInteger,
+						Name:        "hours_per_day",
+						Description: "How far the times move each day (default: 1h for small moves, 2h for larger ones)",
+						Choices: []*discordgo.ApplicationCommandOptionChoice{
+							{Name: "1 hour", Value: 1},
+							{Name: "2 hours", Value: 2},
+						},
+					},
+					medPatientOption(),
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "cancel",
+				Description: "Stop a travel plan, keeping the schedule in the origin timezone",
+				Options: []*discordgo.ApplicationCommandOption{
+					medPatientOption(),
+				},
+			},
+		},
+	},
+	{
+		Name:        "stock",
+		Description: "Track medication supplies and when they run out",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "view",
+				Description: "Show what's left and the projected run-out date",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:         discordgo.ApplicationCommandOptionString,
+						Name:         "medication",
+						Description:  "Medication to show (default: every tracked one)",
+						Autocomplete: true,
+					},
+					medPatientOption(),
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "set",
+				Description: "Record a new supply, e.g. a fresh bottle",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:         discordgo.ApplicationCommandOptionString,
+						Name:         "medication",
+						Description:  "Medication that was refilled",
+						Required:     true,
+						Autocomplete: true,
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "amount",
+						Description: "Amount on hand, e.g. 120 ml or 30 tabs",
+						Required:    true,
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "per_dose",
+						Description: "Amount used by each dose, e.g. 4 ml (default: the medication's dose)",
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionInteger,
+						Name:        "alert_days",
+						Description: "Send a refill alert below this many days of supply (default 3)",
+						MinValue:    &minAlertDays,
+					},
+					medPatientOption(),
+				},
+			},
+		},
+	},
+	{
+		Name:        "weight",
+		Description: "Record a patient's weight for doses prescribed in mg/kg, or show the history",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionNumber,
+				Name:        "kg",
+				Description: "Weight in kilograms (default: show the weight history)",
+				MinValue:    &minWeightKg,
+				MaxValue:    1000,
+			},
+			medPatientOption(),
+		},
+	},
+	{
+		Name:        "setup",
+		Description: "Set up a patient to remind, starting with the first one in a new server",
 	},
 	// Add more commands here
 }
 
+// minPhaseDay is the first day of a course
+var minPhaseDay = float64(1)
+
+// minAlertDays is the shortest refill warning
+var minAlertDays = float64(1)
+
+// minWeightKg is the lightest weight that can be recorded
+var minWeightKg = 0.01
+
+// minEscalationMinutes lets 0 turn an escalation level off
+var minEscalationMinutes = float64(0)
+
+// medNameOption is the required medication name shared by the /med subcommands.
+// Autocomplete suggests existing medications, so it's off when naming a new one.
+func medNameOption(description string, autocomplete bool) *discordgo.ApplicationCommandOption {
+	return &discordgo.ApplicationCommandOption{
+		Type:         discordgo.ApplicationCommandOptionString,
+		Name:         "name",
+		Description:  description,
+		Required:     true,
+		Autocomplete: autocomplete,
+	}
+}
+
+func medPatientOption() *discordgo.ApplicationCommandOption {
+	return &discordgo.ApplicationCommandOption{
+		Type:         discordgo.ApplicationCommandOptionString,
+		Name:         "patient",
+		Description:  "Patient ID or name (needed when there are several patients)",
+		Autocomplete: true,
+	}
+}
+
+func medDaysOption() *discordgo.ApplicationCommandOption {
+	minDays := float64(0)
+	return &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionInteger,
+		Name:        "days",
+		Description: "Course length in days, 0 for ongoing",
+		MinValue:    &minDays,
+	}
+}
+
+func medDosesOption() *discordgo.ApplicationCommandOption {
+	minDoses := float64(0)
+	return &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionInteger,
+		Name:        "doses",
+		Description: "Course length in doses, e.g. 14 tablets, instead of days",
+		MinValue:    &minDoses,
+	}
+}
+
+func medStartOption() *discordgo.ApplicationCommandOption {
+	return &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionString,
+		Name:        "start",
+		Description: "When the course starts: now, HH:MM today, or YYYY-MM-DD HH:MM (default: now)",
+	}
+}
+
+func medIndicationOption() *discordgo.ApplicationCommandOption {
+	return &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionString,
+		Name:        "indication",
+		Description: "What the medication is for",
+	}
+}
+
+func medNotesOption() *discordgo.ApplicationCommandOption {
+	return &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionString,
+		Name:        "notes",
+		Description: "Extra instructions shown in reminders",
+	}
+}
+
+func medRepeatOption() *discordgo.ApplicationCommandOption {
+	return &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionString,
+		Name:        "repeat",
+		Description: "Days to take it: daily, mon, thu, weekdays, every other day, 21/28 or 2026-01-05",
+	}
+}
+
+func medMgPerKgOption() *discordgo.ApplicationCommandOption {
+	minMgPerKg := float64(0)
+	return &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionNumber,
+		Name:        "mg_per_kg",
+		Description: "Dose by weight in mg/kg, computed from the latest /weight, 0 to stop",
+		MinValue:    &minMgPerKg,
+	}
+}
+
+func medConcentrationOption() *discordgo.ApplicationCommandOption {
+	return &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionString,
+		Name:        "concentration",
+		Description: "Liquid strength like 50mg/ml or 250mg/5ml (default: read from the name)",
+	}
+}
+
+func medSpacingOption() *discordgo.ApplicationCommandOption {
+	minHours := float64(0)
+	return &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionInteger,
+		Name:        "spacing",
+		Description: "As-needed only: minimum hours between doses",
+		MinValue:    &minHours,
+	}
+}
+
+func medMaxDailyOption() *discordgo.ApplicationCommandOption {
+	minDoses := float64(0)
+	return &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionInteger,
+		Name:        "max_daily",
+		Description: "As-needed only: most doses in any 24 hours, 0 for no cap",
+		MinValue:    &minDoses,
+	}
+}
+
 // Map command names to handler functions
 var CommandHandlers = map[string]func(s *discordgo.Session, i *discordgo.InteractionCreate){
 	"remind":   commands.RemindCommand,
 	"schedule": commands.ScheduleCommand,
+	"snooze":   commands.SnoozeCommand,
+	"med":      commands.MedCommand,
+	"took":     commands.TookCommand,
+	"timezone": commands.TimezoneCommand,
+	"travel":   commands.TravelCommand,
+	"stock":    commands.StockCommand,
+	"weight":   commands.WeightCommand,
+	"setup":    commands.SetupCommand,
 	// Add more: "hello": commands.HelloCommand, etc.
 }
 
+// Map custom ID prefixes (the part before the first ":") to component handlers
+var ComponentHandlers = map[string]func(s *discordgo.Session, i *discordgo.InteractionCreate){
+	common.DoseButtonPrefix:       commands.DoseButtonHandler,
+	common.SnoozeButtonPrefix:     commands.SnoozeButtonHandler,
+	commands.MedConfirmPrefix:     commands.MedConfirmHandler,
+	commands.SetupComponentPrefix: commands.SetupComponentHandler,
+}
+
+// Map command names to autocomplete handlers, for options marked Autocomplete
+var AutocompleteHandlers = map[string]func(s *discordgo.Session, i *discordgo.InteractionCreate){
+	"remind":   commands.Autocomplete,
+	"schedule": commands.Autocomplete,
+	"snooze":   commands.Autocomplete,
+	"med":      commands.Autocomplete,
+	"took":     commands.Autocomplete,
+	"timezone": commands.Autocomplete,
+	"travel":   commands.Autocomplete,
+	"stock":    commands.Autocomplete,
+	"weight":   commands.Autocomplete,
+}
+
+// Map modal custom ID prefixes (the part before the first ":") to modal submit handlers
+var ModalHandlers = map[string]func(s *discordgo.Session, i *discordgo.InteractionCreate){
+	commands.MedNewModalPrefix: commands.MedNewModalHandler,
+	commands.SetupModalPrefix:  commands.SetupModalHandler,
+}
+
+// DeployCommands registers the handlers that deploy the slash commands and answer them.
+// It must run before the session is opened, so no guild's GuildCreate is missed.
 func DeployCommands(sess *discordgo.Session) {
-	// Remove all global commands
-	globalCmds, err := sess.ApplicationCommands(sess.State.User.ID, "")
-	if err == nil {
-			for _, cmd := range globalCmds {
-					err := sess.ApplicationCommandDelete(sess.State.User.ID, "", cmd.ID)
-					if err != nil {
-							log.Printf("Failed to delete global command %s: %v", cmd.Name, err)
-					} else {
-							log.Printf("Deleted global command: %s", cmd.Name)
-					}
+	// Remove all global commands, each guild gets its own
+	sess.AddHandler(func(s *discordgo.Session, r *discordgo.Ready) {
+		globalCmds, err := s.ApplicationCommands(r.User.ID, "")
+		if err != nil {
+			log.Printf("Cannot list global commands: %v", err)
+			return
+		}
+		for _, cmd := range globalCmds {
+			if err := s.ApplicationCommandDelete(r.User.ID, "", cmd.ID); err != nil {
+				log.Printf("Failed to delete global command %s: %v", cmd.Name, err)
+			} else {
+				log.Printf("Deleted global command: %s", cmd.Name)
 			}
+		}
+	})
+
+	// Bulk overwrite the commands of each guild (this replaces all commands). Discord sends
+	// this for every guild on connecting and for guilds that add the bot later.
+	sess.AddHandler(func(s *discordgo.Session, g *discordgo.GuildCreate) {
+		if _, err := s.ApplicationCommandBulkOverwrite(s.State.User.ID, g.ID, SlashCommands); err != nil {
+			log.Printf("Cannot create slash commands for guild %s: %v", g.ID, err)
+			return
+		}
+		log.Printf("Slash commands deployed to guild %s", g.ID)
+	})
+
+	// Register handler for slash commands, autocomplete, message components and modals
+	sess.AddHandler(func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+		switch i.Type {
+		case discordgo.InteractionApplicationCommand:
+			handleCommand(s, i)
+		case discordgo.InteractionApplicationCommandAutocomplete:
+			handleAutocomplete(s, i)
+		case discordgo.InteractionMessageComponent:
+			handleComponent(s, i)
+		case discordgo.InteractionModalSubmit:
+			handleModal(s, i)
+		}
+	})
+
+	log.Println("Slash command handlers registered.")
+}
+
+// handleCommand dispatches a slash command to its handler
+func handleCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if handler, ok := CommandHandlers[i.ApplicationCommandData().Name]; ok {
+		handler(s, i)
+	} else {
+		fmt.Printf("Unknown command: %s\n", i.ApplicationCommandData().Name)
+		fmt.Printf("Available commands: %v\n", CommandHandlers)
+		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: "Unknown command.",
+				Flags:   discordgo.MessageFlagsEphemeral,
+			},
+		})
 	}
+}
 
-	// Bulk overwrite commands for each guild (this replaces all commands)
-	guilds := sess.State.Guilds
-	for _, guild := range guilds {
-			_, err := sess.ApplicationCommandBulkOverwrite(sess.State.User.ID, guild.ID, SlashCommands)
-			if err != nil {
-					log.Fatalf("Cannot create slash commands for guild %s: %v", guild.ID, err)
-			}
+// handleAutocomplete answers autocomplete requests, with no choices for unknown commands
+func handleAutocomplete(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	name := i.ApplicationCommandData().Name
+	if handler, ok := AutocompleteHandlers[name]; ok {
+		handler(s, i)
+		return
 	}
 
-	// Register handler for slash commands
-	sess.AddHandler(func(s *discordgo.Session, i *discordgo.InteractionCreate) {
-			if handler, ok := CommandHandlers[i.ApplicationCommandData().Name]; ok {
-					handler(s, i)
-			} else {
-					fmt.Printf("Unknown command: %s\n", i.ApplicationCommandData().Name)
-					fmt.Printf("Available commands: %v\n", CommandHandlers)
-					s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-							Type: discordgo.InteractionResponseChannelMessageWithSource,
-							Data: &discordgo.InteractionResponseData{
-									Content: "Unknown command.",
-									Flags:   discordgo.MessageFlagsEphemeral,
-							},
-					})
-			}
+	fmt.Printf("No autocomplete for command: %s\n", name)
+	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{
+			Choices: []*discordgo.ApplicationCommandOptionChoice{},
+		},
 	})
+}
 
-	log.Println("Slash commands deployed successfully.")
+// handleComponent dispatches a button press to the handler registered for its custom ID prefix
+func handleComponent(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	customID := i.MessageComponentData().CustomID
+	prefix, _, _ := strings.Cut(customID, ":")
+	if handler, ok := ComponentHandlers[prefix]; ok {
+		handler(s, i)
+	} else {
+		fmt.Printf("Unknown component: %s\n", customID)
+		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: "Unknown action.",
+				Flags:   discordgo.MessageFlagsEphemeral,
+			},
+		})
+	}
+}
+
+// handleModal dispatches a modal submission to the handler registered for its custom ID prefix
+func handleModal(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	customID := i.ModalSubmitData().CustomID
+	prefix, _, _ := strings.Cut(customID, ":")
+	if handler, ok := ModalHandlers[prefix]; ok {
+		handler(s, i)
+	} else {
+		fmt.Printf("Unknown modal: %s\n", customID)
+		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: "Unknown form.",
+				Flags:   discordgo.MessageFlagsEphemeral,
+			},
+		})
+	}
 }
\ No newline at end of file
@@ -0,0 +1,80 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// defaultStateBackups is how many previous good versions of each state file are kept
+const defaultStateBackups = 5
+
+// writeFileAtomic replaces path with data so a crash leaves either the old file or the
+// new one, never half of it: the data goes to a temporary file that is synced to disk
+// and then renamed over path
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	// Removing fails harmlessly once the rename moved the file
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	// Sync the directory too, so the rename itself survives a crash
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// backupPath returns the name of the nth newest backup of path, e.g. medication_state.json.1
+func backupPath(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
+
+// rotateBackups keeps the file about to be replaced as the newest of keep backups, if it
+// holds valid JSON, shifting the older ones down and dropping the oldest
+func rotateBackups(path string, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+	current, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if !json.Valid(current) {
+		// A damaged file is no good state to go back to
+		return nil
+	}
+
+	for n := keep - 1; n >= 1; n-- {
+		if err := os.Rename(backupPath(path, n), backupPath(path, n+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return writeFileAtomic(backupPath(path, 1), current)
+}
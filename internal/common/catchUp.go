@@ -0,0 +1,100 @@
+package common
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// MissedReminder groups the medications that were due at the same instant but never sent
+type MissedReminder struct {
+	DueAt       time.Time
+	Medications []Medication
+}
+
+// SlotKey identifies one daily reminder time of a medication
+func SlotKey(med Medication, t string) string {
+	return med.Name + "@" + t
+}
+
+// MarkReminded records that the given medications were sent for the slot due at dueAt
+func MarkReminded(patient *Patient, reminders []Medication, dueAt time.Time) {
+	if patient.LastFired == nil {
+		patient.LastFired = make(map[string]string)
+	}
+
+	clock := dueAt.In(patient.LocationAt(dueAt)).Format("15:04")
+	for _, med := range reminders {
+		// Interval doses have no daily slot, the dose log keeps track of them
+		if med.Interval != nil {
+			continue
+		}
+		patient.LastFired[SlotKey(med, clock)] = dueAt.Format(time.RFC3339)
+	}
+}
+
+// GetMissedReminders returns doses that came due within the grace window before now
+// and were never sent. Only slots that have fired before are considered, so a freshly
+// added medication doesn't produce a late reminder, and each medication yields at most
+// its latest missed dose to avoid doubling up.
+func GetMissedReminders(patient *Patient, now time.Time, grace time.Duration) []MissedReminder {
+	if grace <= 0 || len(patient.LastFired) == 0 {
+		return nil
+	}
+
+	// Keyed by the instant, as times in different zones compare unequal as map keys
+	byDue := make(map[int64]*MissedReminder)
+	for _, med := range patient.Medications {
+		if !med.Active {
+			continue
+		}
+
+		var latest time.Time
+		for _, dueAt := range med.DoseTimesBetween(now.Add(-grace), now, patient.LocationAt) {
+			clock := dueAt.In(patient.LocationAt(dueAt)).Format("15:04")
+			fired, ok := patient.LastFired[SlotKey(med, clock)]
+			if !ok {
+				continue
+			}
+			lastFired, err := time.Parse(time.RFC3339, fired)
+			if err != nil || !lastFired.Before(dueAt) {
+				continue
+			}
+
+			if dueAt.After(latest) {
+				latest = dueAt
+			}
+		}
+
+		if latest.IsZero() {
+			continue
+		}
+		slot, ok := byDue[latest.Unix()]
+		if !ok {
+			slot = &MissedReminder{DueAt: latest}
+			byDue[latest.Unix()] = slot
+		}
+		slot.Medications = append(slot.Medications, med.OnDay(latest, patient.LocationAt))
+	}
+
+	missed := make([]MissedReminder, 0, len(byDue))
+	for _, slot := range byDue {
+		missed = append(missed, *slot)
+	}
+	sort.Slice(missed, func(i, j int) bool {
+		return missed[i].DueAt.Before(missed[j].DueAt)
+	})
+	return missed
+}
+
+// FormatLateReminderMessage creates a reminder message clearly marked as late
+func FormatLateReminderMessage(patient *Patient, reminders []Medication, dueAt time.Time) string {
+	if len(reminders) == 0 {
+		return ""
+	}
+
+	message := "⚠️ **LATE REMINDER** ⚠️\n"
+	message += fmt.Sprintf("These doses were due at **%s** but the reminder could not be sent on time.\n", dueAt.In(patient.LocationAt(dueAt)).Format("15:04"))
+	message += "Please check whether they were already given before giving them now.\n\n"
+	return message + FormatReminderMessage(patient, reminders)
+}
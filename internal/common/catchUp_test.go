@@ -0,0 +1,56 @@
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMissedRemindersUseReminderSlots(t *testing.T) {
+	newYork := mustLoadLocation("America/New_York")
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, newYork)
+	patient := &Patient{
+		ID:       "a",
+		Name:     "A",
+		Timezone: "America/New_York",
+		Medications: []Medication{
+			{Name: "A1", Times: []string{"08:00"}, Active: true, Start: start},
+			{Name: "B1", Times: []string{"08:00"}, Active: true, Start: start},
+		},
+	}
+
+	// Times in UTC still mark the slot by the patient's own clock
+	yesterday := time.Date(2026, 3, 19, 8, 0, 0, 0, newYork).UTC()
+	MarkReminded(patient, patient.Medications, yesterday)
+	if got := patient.LastFired["A1@08:00"]; got != yesterday.Format(time.RFC3339) {
+		t.Fatalf("A1@08:00 last fired %q, want %q", got, yesterday.Format(time.RFC3339))
+	}
+
+	now := time.Date(2026, 3, 20, 8, 20, 0, 0, newYork).UTC()
+	missed := GetMissedReminders(patient, now, time.Hour)
+	if len(missed) != 1 {
+		t.Fatalf("got %d missed reminders, want one for both medications", len(missed))
+	}
+	if want := time.Date(2026, 3, 20, 8, 0, 0, 0, newYork); !missed[0].DueAt.Equal(want) || len(missed[0].Medications) != 2 {
+		t.Errorf("got %d medications due at %v, want 2 due at %v", len(missed[0].Medications), missed[0].DueAt, want)
+	}
+
+	MarkReminded(patient, missed[0].Medications, missed[0].DueAt)
+	if missed := GetMissedReminders(patient, now, time.Hour); len(missed) != 0 {
+		t.Errorf("got %d missed reminders after sending them, want none", len(missed))
+	}
+}
+
+func TestMissedRemindersSkipNewSlots(t *testing.T) {
+	patient := &Patient{
+		ID:          "a",
+		Name:        "A",
+		Medications: []Medication{{Name: "A1", Times: []string{"08:00", "20:00"}, Active: true, Start: time.Date(2026, 3, 1, 0, 0, 0, 0, DefaultLocation)}},
+	}
+	MarkReminded(patient, patient.Medications, time.Date(2026, 3, 19, 8, 0, 0, 0, DefaultLocation))
+
+	// 20:00 never fired, so it was only just added
+	now := time.Date(2026, 3, 19, 20, 30, 0, 0, DefaultLocation)
+	if missed := GetMissedReminders(patient, now, time.Hour); len(missed) != 0 {
+		t.Errorf("got %d missed reminders, want none for a slot that never fired", len(missed))
+	}
+}
@@ -0,0 +1,215 @@
+package common
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CourseProgress is how far along a medication's course is
+type CourseProgress struct {
+	Doses         int // doses in the whole course, 0 when they can't be listed in advance
+	Taken         int // doses confirmed taken in the dose log, or sent when they aren't acknowledged
+	Remaining     int // doses still to come
+	DaysRemaining int // course days left, counted in whole days from the start's time of day
+}
+
+// CourseEnd returns when a course with a set length ends: TotalDays after it started, at
+// the same time of day. A course started at 18:00 for 7 days ends on day 8 at 18:00,
+// in the timezone the patient is in by then.
+func (m Medication) CourseEnd(zone Locator) (time.Time, bool) {
+	if m.TotalDays <= 0 || m.Start.IsZero() {
+		return time.Time{}, false
+	}
+	start := m.Start.In(zone(m.Start))
+	loc := zone(m.Start.AddDate(0, 0, m.TotalDays))
+	return LocalTime(start.Year(), start.Month(), start.Day()+m.TotalDays, start.Hour(), start.Minute(), loc), true
+}
+
+// InCourse reports whether a dose at t belongs to the course, so the first day only has
+// the doses after the start and the last day only those before the end
+func (m Medication) InCourse(at time.Time, zone Locator) bool {
+	if !m.Start.IsZero() && at.Before(m.Start) {
+		return false
+	}
+	if end, ok := m.CourseEnd(zone); ok && !at.Before(end) {
+		return false
+	}
+	return true
+}
+
+// Progress counts the doses of a course with a set length from its schedule and the dose
+// log. A dose is still to come until its time has passed or the log already has it.
+// Interval and as-needed doses can't be listed ahead, so only the days are counted.
+// A course of TotalDoses lasts until that many doses were taken, whenever that is.
+func (m Medication) Progress(patientID string, log *DoseLog, now time.Time, zone Locator) CourseProgress {
+	end, ok := m.CourseEnd(zone)
+	if !ok && m.TotalDoses <= 0 {
+		return CourseProgress{}
+	}
+
+	var progress CourseProgress
+	logged := make(map[int64]bool)
+	if log != nil {
+		for _, e := range log.Entries {
+			if !entryMatches(e, patientID, m.Name) || !m.InCourse(e.DueAt, zone) {
+				continue
+			}
+			logged[e.DueAt.Unix()] = true
+			if e.Status == DoseTaken || e.Status == DoseSent {
+				progress.Taken++
+			}
+		}
+	}
+
+	if m.TotalDoses > 0 {
+		progress.Doses = m.TotalDoses
+		progress.Remaining = max(m.TotalDoses-progress.Taken, 0)
+		return progress
+	}
+
+	// A course started at 18:00 has its days run from 18:00 to 18:00
+	from := now
+	if from.Before(m.Start) {
+		from = m.Start
+	}
+	if from.Before(end) {
+		progress.DaysRemaining = int((end.Sub(from) + 24*time.Hour - 1) / (24 * time.Hour))
+	}
+	if m.Interval != nil || m.PRN != nil {
+		return progress
+	}
+
+	for _, at := range m.DoseTimesBetween(m.Start.Add(-time.Nanosecond), end.Add(-time.Nanosecond), zone) {
+		progress.Doses++
+		if at.After(now) && !logged[at.Unix()] {
+			progress.Remaining++
+		}
+	}
+	if progress.Remaining == 0 {
+		progress.DaysRemaining = 0
+	}
+	return progress
+}
+
+// daysBetween returns how many local calendar days after from's day to's day is, each
+// day's date taken in the timezone in effect then
+func daysBetween(from, to time.Time, zone Locator) int {
+	a := from.In(zone(from))
+	b := to.In(zone(to))
+	dayA := time.Date(a.Year(), a.Month(), a.Day(), 0, 0, 0, 0, time.UTC)
+	dayB := time.Date(b.Year(), b.Month(), b.Day(), 0, 0, 0, 0, time.UTC)
+	return int(dayB.Sub(dayA).Hours() / 24)
+}
+
+// UpdateRemaining recomputes the days and doses left in the course as of now and
+// deactivates the medication once the course has ended or its last dose was given
+func (m *Medication) UpdateRemaining(patientID string, log *DoseLog, now time.Time, zone Locator) {
+	if m.TotalDoses > 0 {
+		progress := m.Progress(patientID, log, now, zone)
+		m.DaysRemaining = 0
+		m.DosesRemaining = progress.Remaining
+		if progress.Remaining == 0 {
+			m.Active = false
+		}
+		return
+	}
+
+	end, ok := m.CourseEnd(zone)
+	if !ok {
+		return
+	}
+
+	progress := m.Progress(patientID, log, now, zone)
+	m.DaysRemaining = progress.DaysRemaining
+	m.DosesRemaining = progress.Remaining
+
+	if !now.Before(end) {
+		m.Active = false
+		m.DaysRemaining = 0
+		m.DosesRemaining = 0
+	}
+}
+
+// RemainingText describes what is left of a course, e.g. "5/7 days (9 doses left)" or
+// "9 of 14 doses"
+func (m Medication) RemainingText() string {
+	if m.TotalDoses > 0 {
+		return fmt.Sprintf("%d of %d doses", m.DosesRemaining, m.TotalDoses)
+	}
+
+	text := fmt.Sprintf("%d/%d days", m.DaysRemaining, m.TotalDays)
+	switch {
+	case m.DosesRemaining == 1:
+		text += " (last dose left)"
+	case m.DosesRemaining > 1:
+		text += fmt.Sprintf(" (%d doses left)", m.DosesRemaining)
+	}
+	return text
+}
+
+// ParseCourseLength reads a course length like "7", "7 days" or "14 doses". Any other
+// unit, like "14 tablets", counts doses. Empty or 0 is an ongoing course.
+func ParseCourseLength(value string) (days, doses int, err error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, 0, nil
+	}
+
+	fields := strings.Fields(value)
+	n, err := strconv.Atoi(fields[0])
+	if err != nil || n < 0 || len(fields) > 2 {
+		return 0, 0, fmt.Errorf("invalid course length %q, expected e.g. 7 days or 14 doses", value)
+	}
+	if len(fields) == 1 || strings.HasPrefix(strings.ToLower(fields[1]), "day") {
+		return n, 0, nil
+	}
+	return 0, n, nil
+}
+
+// ParseStart reads when a course starts: "now", "HH:MM" today, "YYYY-MM-DD" at midnight
+// or "YYYY-MM-DD HH:MM", all in loc
+func ParseStart(value string, now time.Time, loc *time.Location) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	local := now.In(loc)
+	if value == "" || strings.EqualFold(value, "now") {
+		return local.Truncate(time.Minute), nil
+	}
+
+	if hour, minute, err := ParseTimeOfDay(value); err == nil {
+		return LocalTime(local.Year(), local.Month(), local.Day(), hour, minute, loc), nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04", "2006-01-02T15:04", "2006-01-02"} {
+		t, err := time.ParseInLocation(layout, value, loc)
+		if err == nil {
+			return LocalTime(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), loc), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid start %q, expected now, HH:MM, YYYY-MM-DD or YYYY-MM-DD HH:MM", value)
+}
+
+// upgradeStartDates turns the start dates of older state files into start timestamps at
+// midnight, which is how they were counted before
+func upgradeStartDates(schedule *MedicationSchedule) []string {
+	var changes []string
+	for p := range schedule.Patients {
+		patient := &schedule.Patients[p]
+		loc := patient.Location()
+		for i := range patient.Medications {
+			med := &patient.Medications[i]
+			if !med.Start.IsZero() || med.StartDate == "" {
+				continue
+			}
+			date, err := time.Parse("2006-01-02", med.StartDate)
+			if err != nil {
+				fmt.Printf("Error parsing start date for %s: %v\n", med.Name, err)
+				continue
+			}
+			med.Start = LocalTime(date.Year(), date.Month(), date.Day(), 0, 0, loc)
+			med.StartDate = ""
+			changes = append(changes, fmt.Sprintf("%s's %s starts %s", patient.Name, med.Name, med.Start.In(loc).Format("2006-01-02 15:04 MST")))
+		}
+	}
+	return changes
+}
@@ -0,0 +1,21 @@
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProgressCountsLegacyDoses(t *testing.T) {
+	start := time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC)
+	med := Medication{Name: "A1", Times: []string{"08:00"}, Active: true, Start: start, TotalDoses: 3}
+	log := &DoseLog{}
+	for i, patient := range []string{"", "", "a"} {
+		at := start.AddDate(0, 0, i)
+		log.Entries = append(log.Entries, DoseEntry{Patient: patient, Medication: "a1", DueAt: at, Status: DoseTaken, ActedAt: at})
+	}
+
+	med.UpdateRemaining("a", log, start.AddDate(0, 0, 3), FixedLocator(time.UTC))
+	if med.DosesRemaining != 0 || med.Active {
+		t.Errorf("got %d doses left, active %v, want the course finished", med.DosesRemaining, med.Active)
+	}
+}
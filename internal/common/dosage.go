@@ -0,0 +1,469 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Rational is an exact fraction, so doses like 1/2 tab add up without rounding
+type Rational struct {
+	Num int64
+	Den int64
+}
+
+// NewRational returns num/den in lowest terms with a positive denominator
+func NewRational(num, den int64) Rational {
+	if den == 0 {
+		return Rational{}
+	}
+	if den < 0 {
+		num, den = -num, -den
+	}
+	g := gcd(abs64(num), den)
+	if g == 0 {
+		return Rational{0, 1}
+	}
+	return Rational{num / g, den / g}
+}
+
+// gcd returns the greatest common divisor of two non-negative numbers
+func gcd(a, b int64) int64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// abs64 returns the absolute value of n
+func abs64(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// unicodeFractions are the vulgar fractions accepted in doses
+var unicodeFractions = map[string]Rational{"½": {1, 2}, "¼": {1, 4}, "¾": {3, 4}, "⅓": {1, 3}, "⅔": {2, 3}}
+
+// ParseRational reads "2", "1/2", "1 1/2", "1½" or "1.5"
+func ParseRational(value string) (Rational, error) {
+	value = strings.TrimSpace(value)
+	for symbol, frac := range unicodeFractions {
+		if whole, ok := strings.CutSuffix(value, symbol); ok {
+			r := frac
+			if whole = strings.TrimSpace(whole); whole != "" {
+				w, err := ParseRational(whole)
+				if err != nil {
+					return Rational{}, err
+				}
+				return w.Add(frac)
+			}
+			return r, nil
+		}
+	}
+
+	// A mixed number like "1 1/2"
+	if whole, frac, ok := strings.Cut(value, " "); ok {
+		w, err := ParseRational(whole)
+		if err != nil {
+			return Rational{}, err
+		}
+		f, err := ParseRational(frac)
+		if err != nil {
+			return Rational{}, err
+		}
+		return w.Add(f)
+	}
+
+	if num, den, ok := strings.Cut(value, "/"); ok {
+		n, err := strconv.ParseInt(num, 10, 64)
+		if err != nil {
+			return Rational{}, fmt.Errorf("invalid amount %q", value)
+		}
+		d, err := strconv.ParseInt(den, 10, 64)
+		if err != nil || d == 0 {
+			return Rational{}, fmt.Errorf("invalid amount %q", value)
+		}
+		return NewRational(n, d), nil
+	}
+
+	if whole, frac, ok := strings.Cut(value, "."); ok {
+		if len(frac) == 0 || len(frac) > 6 {
+			return Rational{}, fmt.Errorf("invalid amount %q", value)
+		}
+		if whole == "" {
+			whole = "0"
+		}
+		n, err := strconv.ParseInt(whole+frac, 10, 64)
+		if err != nil {
+			return Rational{}, fmt.Errorf("invalid amount %q", value)
+		}
+		den := int64(1)
+		for range frac {
+			den *= 10
+		}
+		return NewRational(n, den), nil
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return Rational{}, fmt.Errorf("invalid amount %q", value)
+	}
+	return NewRational(n, 1), nil
+}
+
+// ErrAmountOverflow is returned by arithmetic whose exact result doesn't fit in a Rational
+var ErrAmountOverflow = errors.New("amount too large to compute exactly")
+
+// norm returns r with the zero value as 0/1, so it can be computed with
+func (r Rational) norm() Rational {
+	if r.Den == 0 {
+		return Rational{0, 1}
+	}
+	return r
+}
+
+// Add returns r + o. Only the part of the denominators they don't share is multiplied,
+// and an error is returned when the result still overflows.
+func (r Rational) Add(o Rational) (Rational, error) {
+	r, o = r.norm(), o.norm()
+	g := gcd(r.Den, o.Den)
+	a, ok1 := mul64(r.Num, o.Den/g)
+	b, ok2 := mul64(o.Num, r.Den/g)
+	num, ok3 := add64(a, b)
+	den, ok4 := mul64(r.Den, o.Den/g)
+	if !ok1 || !ok2 || !ok3 || !ok4 {
+		return Rational{}, ErrAmountOverflow
+	}
+	return NewRational(num, den), nil
+}
+
+// Sub returns r - o
+func (r Rational) Sub(o Rational) (Rational, error) {
+	return r.Add(o.Neg())
+}
+
+// Neg returns -r
+func (r Rational) Neg() Rational {
+	r = r.norm()
+	return Rational{-r.Num, r.Den}
+}
+
+// Mul returns r × o. Each numerator is first reduced against the other denominator, and
+// an error is returned when the result still overflows.
+func (r Rational) Mul(o Rational) (Rational, error) {
+	r, o = r.norm(), o.norm()
+	if r.Num == 0 || o.Num == 0 {
+		return Rational{0, 1}, nil
+	}
+	g1 := gcd(abs64(r.Num), o.Den)
+	g2 := gcd(abs64(o.Num), r.Den)
+	num, ok1 := mul64(r.Num/g1, o.Num/g2)
+	den, ok2 := mul64(r.Den/g2, o.Den/g1)
+	if !ok1 || !ok2 {
+		return Rational{}, ErrAmountOverflow
+	}
+	return NewRational(num, den), nil
+}
+
+// Div returns r ÷ o, zero when o is
+func (r Rational) Div(o Rational) (Rational, error) {
+	o = o.norm()
+	if o.Num == 0 {
+		return Rational{0, 1}, nil
+	}
+	return r.Mul(NewRational(o.Den, o.Num))
+}
+
+// mul64 returns a × b, or false when it overflows
+func mul64(a, b int64) (int64, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+	c := a * b
+	if c/b != a || (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+		return 0, false
+	}
+	return c, true
+}
+
+// add64 returns a + b, or false when it overflows
+func add64(a, b int64) (int64, bool) {
+	c := a + b
+	if (c > a) != (b > 0) {
+		return 0, false
+	}
+	return c, true
+}
+
+// Floor returns the largest whole number not above r
+func (r Rational) Floor() int64 {
+	if r.Den == 0 {
+		return 0
+	}
+	n := r.Num / r.Den
+	if r.Num%r.Den < 0 {
+		n--
+	}
+	return n
+}
+
+// Cmp returns -1, 0 or 1 as r is less than, equal to or greater than o. The zero value
+// compares as zero, and the cross products are compared exactly however large.
+func (r Rational) Cmp(o Rational) int {
+	r, o = r.norm(), o.norm()
+	a := new(big.Int).Mul(big.NewInt(r.Num), big.NewInt(o.Den))
+	b := new(big.Int).Mul(big.NewInt(o.Num), big.NewInt(r.Den))
+	return a.Cmp(b)
+}
+
+// IsZero reports whether r is zero, including the zero value
+func (r Rational) IsZero() bool {
+	return r.Num == 0
+}
+
+// Float64 returns r as a floating point number
+func (r Rational) Float64() float64 {
+	if r.Den == 0 {
+		return 0
+	}
+	return float64(r.Num) / float64(r.Den)
+}
+
+// String renders r as a whole or mixed number, e.g. "2", "1/2" or "1 1/2"
+func (r Rational) String() string {
+	if r.Den == 0 || r.Den == 1 {
+		return strconv.FormatInt(r.Num, 10)
+	}
+	sign := ""
+	num := r.Num
+	if num < 0 {
+		sign, num = "-", -num
+	}
+	whole, rest := num/r.Den, num%r.Den
+	if whole == 0 {
+		return fmt.Sprintf("%s%d/%d", sign, rest, r.Den)
+	}
+	return fmt.Sprintf("%s%d %d/%d", sign, whole, rest, r.Den)
+}
+
+// Decimal renders r with up to three decimals, e.g. "1.5", or returns false when it
+// can't be written exactly that way, like 1/3
+func (r Rational) Decimal() (string, bool) {
+	if r.Den == 0 {
+		return "0", true
+	}
+	for places, scale := 0, int64(1); places <= 3; places, scale = places+1, scale*10 {
+		if scale%r.Den == 0 {
+			return strconv.FormatFloat(r.Float64(), 'f', places, 64), true
+		}
+	}
+	return "", false
+}
+
+// MarshalJSON stores r as a number when it has an exact decimal, and as text like "1/3"
+// otherwise
+func (r Rational) MarshalJSON() ([]byte, error) {
+	if decimal, ok := r.Decimal(); ok {
+		return []byte(decimal), nil
+	}
+	return json.Marshal(r.String())
+}
+
+// UnmarshalJSON reads an amount saved as a number or as text. Numbers saved as floating
+// point by older builds, like 0.3333333333333333, are read as the nearest small fraction.
+func (r *Rational) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		parsed, err := ParseRational(text)
+		if err != nil {
+			return err
+		}
+		*r = parsed
+		return nil
+	}
+
+	if parsed, err := ParseRational(string(data)); err == nil {
+		*r = parsed
+		return nil
+	}
+	var f float64
+	if err := json.Unmarshal(data, &f); err != nil {
+		return fmt.Errorf("invalid amount %s", data)
+	}
+	*r = rationalFromFloat(f)
+	return nil
+}
+
+// rationalFromFloat returns the fraction with the smallest denominator up to 1000 that is
+// within rounding error of f, or f to six decimals when there is none
+func rationalFromFloat(f float64) Rational {
+	for den := int64(1); den <= 1000; den++ {
+		num := math.Round(f * float64(den))
+		if math.Abs(num/float64(den)-f) < 1e-9 {
+			return NewRational(int64(num), den)
+		}
+	}
+	return NewRational(int64(math.Round(f*1e6)), 1e6)
+}
+
+// DoseUnit is one of the units doses are measured in
+type DoseUnit string
+
+const (
+	UnitML   DoseUnit = "ml"
+	UnitMG   DoseUnit = "mg"
+	UnitTab  DoseUnit = "tab"
+	UnitDrop DoseUnit = "drop"
+	UnitPuff DoseUnit = "puff"
+	UnitIU   DoseUnit = "IU"
+)
+
+// doseUnitNames maps the ways a unit is written to the unit
+var doseUnitNames = map[string]DoseUnit{
+	"ml": UnitML, "milliliter": UnitML, "milliliters": UnitML, "millilitre": UnitML, "millilitres": UnitML, "cc": UnitML,
+	"mg": UnitMG, "milligram": UnitMG, "milligrams": UnitMG,
+	"tab": UnitTab, "tabs": UnitTab, "tablet": UnitTab, "tablets": UnitTab, "pill": UnitTab, "pills": UnitTab,
+	"drop": UnitDrop, "drops": UnitDrop, "gtt": UnitDrop, "gtts": UnitDrop,
+	"puff": UnitPuff, "puffs": UnitPuff,
+	"iu": UnitIU, "unit": UnitIU, "units": UnitIU,
+}
+
+// ParseDoseUnit reads a unit like "ml", "tablets" or "IU"
+func ParseDoseUnit(value string) (DoseUnit, error) {
+	unit, ok := doseUnitNames[strings.ToLower(strings.TrimSpace(value))]
+	if !ok {
+		return "", fmt.Errorf("unknown unit %q, expected one of ml, mg, tab, drop, puff or IU", value)
+	}
+	return unit, nil
+}
+
+// countable reports whether the unit counts whole things, which are written as fractions
+func (u DoseUnit) countable() bool {
+	return u == UnitTab || u == UnitDrop || u == UnitPuff
+}
+
+// Dose is an amount of a medication in a known unit, e.g. 1/2 tab or 1.5 ml. A dose
+// from an older state file that can't be read keeps its text, so it still shows.
+type Dose struct {
+	Amount Rational
+	Unit   DoseUnit
+	text   string
+}
+
+// ParseDose reads a dose like "2 ml", "1/2 tab", "1 1/2 tablets" or "0.5ml". A decimal
+// comma like "1,5 ml" and a spaced fraction like "1 / 2 tab" are rejected on purpose:
+// the comma reads as a list of doses, and "1 / 2" too easily is, or was meant as, "1 1/2".
+func ParseDose(value string) (Dose, error) {
+	value = strings.TrimSpace(value)
+	split := strings.IndexFunc(value, func(r rune) bool {
+		return !strings.ContainsRune("0123456789./ ½¼¾⅓⅔", r)
+	})
+	if split <= 0 {
+		return Dose{}, fmt.Errorf("invalid dose %q, expected an amount and a unit like 2 ml or 1/2 tab", value)
+	}
+
+	amount, err := ParseRational(value[:split])
+	if err != nil {
+		return Dose{}, fmt.Errorf("invalid dose %q, expected an amount and a unit like 2 ml or 1/2 tab", value)
+	}
+	if amount.Cmp(Rational{0, 1}) <= 0 {
+		return Dose{}, fmt.Errorf("a dose must be more than zero")
+	}
+	unit, err := ParseDoseUnit(value[split:])
+	if err != nil {
+		return Dose{}, err
+	}
+	return Dose{Amount: amount, Unit: unit}, nil
+}
+
+// IsZero reports whether no dose is set
+func (d Dose) IsZero() bool {
+	return d.Amount.IsZero() && d.text == ""
+}
+
+// Structured reports whether the dose has an amount and unit that can be computed with
+func (d Dose) Structured() bool {
+	return !d.Amount.IsZero() && d.Unit != ""
+}
+
+// String renders the dose as friendly text, e.g. "1/2 tab", "1 1/2 tabs" or "1.5 ml"
+func (d Dose) String() string {
+	if !d.Structured() {
+		return d.text
+	}
+
+	amount := d.Amount.String()
+	if !d.Unit.countable() {
+		if decimal, ok := d.Amount.Decimal(); ok {
+			amount = decimal
+		}
+	}
+	unit := string(d.Unit)
+	if d.Unit.countable() && d.Amount.Cmp(Rational{1, 1}) > 0 {
+		unit += "s"
+	}
+	return amount + " " + unit
+}
+
+// Times returns the dose taken n times over, e.g. a day's total
+func (d Dose) Times(n int) (Dose, error) {
+	if !d.Structured() {
+		return d, nil
+	}
+	amount, err := d.Amount.Mul(NewRational(int64(n), 1))
+	if err != nil {
+		return Dose{}, err
+	}
+	return Dose{Amount: amount, Unit: d.Unit}, nil
+}
+
+// Sub returns how much larger d is than o, which must be in the same unit
+func (d Dose) Sub(o Dose) (Dose, error) {
+	if !d.Structured() || !o.Structured() || d.Unit != o.Unit {
+		return Dose{}, fmt.Errorf("can't compare %s with %s", d, o)
+	}
+	amount, err := d.Amount.Sub(o.Amount)
+	if err != nil {
+		return Dose{}, err
+	}
+	return Dose{Amount: amount, Unit: d.Unit}, nil
+}
+
+// DoseText renders the dose with the day's total when it's taken more than once a day,
+// e.g. "2 ml (4 ml a day)"
+func (m Medication) DoseText() string {
+	if !m.Dose.Structured() || len(m.Times) < 2 {
+		return m.Dose.String()
+	}
+	daily, err := m.Dose.Times(len(m.Times))
+	if err != nil {
+		return m.Dose.String()
+	}
+	return fmt.Sprintf("%s (%s a day)", m.Dose, daily)
+}
+
+// MarshalJSON stores the dose as its text, as state files always have
+func (d Dose) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON reads a dose from its text, keeping text that can't be parsed as is
+func (d *Dose) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+	parsed, err := ParseDose(text)
+	if err != nil {
+		*d = Dose{text: strings.TrimSpace(text)}
+		return nil
+	}
+	*d = parsed
+	return nil
+}
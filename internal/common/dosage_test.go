@@ -0,0 +1,94 @@
+package common
+
+import (
+	"errors"
+	"testing"
+)
+
+// MustParseDose parses a dose that is known to be valid
+func MustParseDose(value string) Dose {
+	d, err := ParseDose(value)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func TestParseDose(t *testing.T) {
+	for value, want := range map[string]Dose{
+		"2 ml":          {Amount: NewRational(2, 1), Unit: UnitML},
+		"0.5ml":         {Amount: NewRational(1, 2), Unit: UnitML},
+		".25 ml":        {Amount: NewRational(1, 4), Unit: UnitML},
+		"1/2 tab":       {Amount: NewRational(1, 2), Unit: UnitTab},
+		"1 1/2 tablets": {Amount: NewRational(3, 2), Unit: UnitTab},
+		"1½ tabs":       {Amount: NewRational(3, 2), Unit: UnitTab},
+		"⅓ tab":         {Amount: NewRational(1, 3), Unit: UnitTab},
+		"2 drops":       {Amount: NewRational(2, 1), Unit: UnitDrop},
+		" 10 IU ":       {Amount: NewRational(10, 1), Unit: UnitIU},
+	} {
+		got, err := ParseDose(value)
+		if err != nil || got != want {
+			t.Errorf("ParseDose(%q) = %+v, %v, want %+v", value, got, err, want)
+		}
+	}
+
+	for _, value := range []string{
+		"", "ml", "2", "0 ml", "2 spoons", "1/0 tab", "0.1234567 ml",
+		// A decimal comma and a spaced fraction are ambiguous, see ParseDose
+		"1,5 ml", "1 / 2 tab",
+		// Amounts that don't fit are refused rather than wrapped around
+		"9223372036854775807 1/2 tab", "99999999999999999999 ml",
+	} {
+		if got, err := ParseDose(value); err == nil {
+			t.Errorf("ParseDose(%q) = %+v, want an error", value, got)
+		}
+	}
+}
+
+func TestRationalArithmetic(t *testing.T) {
+	third, half := NewRational(1, 3), NewRational(1, 2)
+	if sum, err := third.Add(half); err != nil || sum != NewRational(5, 6) {
+		t.Errorf("1/3 + 1/2 = %s, %v, want 5/6", sum, err)
+	}
+	if diff, err := third.Sub(half); err != nil || diff != NewRational(-1, 6) {
+		t.Errorf("1/3 - 1/2 = %s, %v, want -1/6", diff, err)
+	}
+	if quotient, err := NewRational(5, 1).Div(half); err != nil || quotient != NewRational(10, 1) {
+		t.Errorf("5 ÷ 1/2 = %s, %v, want 10", quotient, err)
+	}
+
+	// Reducing first keeps results that fit from overflowing on the way
+	big := NewRational(1<<62, 3)
+	if product, err := big.Mul(NewRational(3, 1<<61)); err != nil || product != NewRational(2, 1) {
+		t.Errorf("2^62/3 × 3/2^61 = %s, %v, want 2", product, err)
+	}
+	if sum, err := NewRational(1, 1<<62).Add(NewRational(1, 1<<62)); err != nil || sum != NewRational(1, 1<<61) {
+		t.Errorf("1/2^62 + 1/2^62 = %s, %v, want 1/2^61", sum, err)
+	}
+
+	if _, err := big.Mul(big); !errors.Is(err, ErrAmountOverflow) {
+		t.Errorf("2^62/3 squared gave %v, want ErrAmountOverflow", err)
+	}
+	if _, err := NewRational(1<<62, 1).Add(NewRational(1<<62, 1)); !errors.Is(err, ErrAmountOverflow) {
+		t.Errorf("2^62 + 2^62 gave %v, want ErrAmountOverflow", err)
+	}
+	if _, err := NewRational(1, 1<<40).Add(NewRational(1, 3<<40)); err != nil {
+		t.Errorf("denominators sharing 2^40 gave %v", err)
+	}
+}
+
+func TestRationalCmpZeroValue(t *testing.T) {
+	if NewRational(-1, 2).Cmp(Rational{}) >= 0 {
+		t.Error("-1/2 isn't less than the zero value")
+	}
+	if NewRational(1, 2).Cmp(Rational{}) <= 0 {
+		t.Error("1/2 isn't more than the zero value")
+	}
+	if (Rational{}).Cmp(NewRational(0, 1)) != 0 {
+		t.Error("the zero value isn't equal to 0")
+	}
+	// Cross products beyond int64 still compare exactly
+	if NewRational(1<<62, 3).Cmp(NewRational(1<<62-1, 3)) <= 0 {
+		t.Error("large amounts compared wrongly")
+	}
+}
@@ -0,0 +1,226 @@
+package common
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// DoseStatus is the outcome recorded for a reminded dose
+type DoseStatus string
+
+const (
+	DosePending DoseStatus = "pending"
+	DoseTaken   DoseStatus = "taken"
+	DoseSkipped DoseStatus = "skipped"
+	DoseSnoozed DoseStatus = "snoozed"
+	// DoseCancelled marks a dose whose medication went away before it was handled
+	DoseCancelled DoseStatus = "cancelled"
+	// DoseSent marks a dose reminded to a patient who doesn't acknowledge doses, counted as given
+	DoseSent DoseStatus = "sent"
+)
+
+// DoseEntry is a single reminded dose and what happened to it
+type DoseEntry struct {
+	ReminderID string     `json:"reminder_id"` // shared by every dose sent in the same message
+	Patient    string     `json:"patient"`     // patient ID
+	Medication string     `json:"medication"`
+	Dose       string     `json:"dose"`
+	DueAt      time.Time  `json:"due_at"`
+	SentAt     time.Time  `json:"sent_at"`
+	Status     DoseStatus `json:"status"`
+	ActedBy    string     `json:"acted_by,omitempty"` // Discord user ID
+	ActedAt    time.Time  `json:"acted_at"`
+	ChannelID  string     `json:"channel_id,omitempty"`
+	MessageID  string     `json:"message_id,omitempty"`
+	// EscalationLevel is the last escalation step already sent for this dose
+	EscalationLevel int `json:"escalation_level,omitempty"`
+	// SnoozedUntil is when a snoozed dose is reminded again
+	SnoozedUntil time.Time `json:"snoozed_until"`
+}
+
+// DoseLog holds every dose that was reminded
+type DoseLog struct {
+	Entries []DoseEntry `json:"entries"`
+}
+
+// doseLogFile is where the JSON store keeps the dose log, alongside the medication state file
+const doseLogFile = "dose_log.json"
+
+// DoseButtonPrefix starts the custom ID of every dose acknowledgement button
+const DoseButtonPrefix = "dose"
+
+var doseLogMutex sync.Mutex
+
+// reminderSeq keeps reminder IDs unique when several are created at once
+var reminderSeq atomic.Uint64
+
+// LoadDoseLog loads the dose log from file
+func LoadDoseLog() (*DoseLog, error) {
+	doseLogMutex.Lock()
+	defer doseLogMutex.Unlock()
+	return readDoseLog()
+}
+
+// UpdateDoseLog loads the dose log, applies fn and saves the doses it added or changed
+// as one step. Doses can't be removed from the log.
+func UpdateDoseLog(fn func(log *DoseLog) error) error {
+	doseLogMutex.Lock()
+	defer doseLogMutex.Unlock()
+
+	log, err := readDoseLog()
+	if err != nil {
+		return err
+	}
+	before := slices.Clone(log.Entries)
+	if err := fn(log); err != nil {
+		return err
+	}
+
+	changes, err := diffDoseLog(before, log.Entries)
+	if err != nil {
+		return err
+	}
+	if changes.Empty() {
+		return nil
+	}
+	if err := currentStore().SaveDoseChanges(changes); err != nil {
+		return err
+	}
+
+	// Pending doses drive escalations, so the scheduler needs to re-plan
+	notifyStateChange()
+	return nil
+}
+
+// readDoseLog reads the dose log from the store, the caller must hold doseLogMutex
+func readDoseLog() (*DoseLog, error) {
+	return currentStore().LoadDoseLog()
+}
+
+// NewReminderID returns a unique ID for a reminder message
+func NewReminderID() string {
+	return strconv.FormatInt(time.Now().UnixNano(), 36) + strconv.FormatUint(reminderSeq.Add(1), 36)
+}
+
+// Reminder returns pointers to every entry that belongs to the given reminder
+func (l *DoseLog) Reminder(reminderID string) []*DoseEntry {
+	var entries []*DoseEntry
+	for i := range l.Entries {
+		if l.Entries[i].ReminderID == reminderID {
+			entries = append(entries, &l.Entries[i])
+		}
+	}
+	return entries
+}
+
+// RecordReminder adds a dose entry for every medication in a reminder, pending until it is
+// acknowledged, or already sent for patients who don't acknowledge doses
+func RecordReminder(reminderID string, patient *Patient, reminders []Medication, dueAt time.Time) error {
+	status := DosePending
+	if patient.SkipAcknowledgement {
+		status = DoseSent
+	}
+
+	now := time.Now()
+	return UpdateDoseLog(func(log *DoseLog) error {
+		for _, med := range reminders {
+			log.Entries = append(log.Entries, DoseEntry{
+				ReminderID: reminderID,
+				Patient:    patient.ID,
+				Medication: med.Name,
+				Dose:       med.Dose.String(),
+				DueAt:      dueAt,
+				SentAt:     now,
+				Status:     status,
+			})
+		}
+		return nil
+	})
+}
+
+// RecordReminderMessage stores where a reminder was delivered so it can be edited later
+func RecordReminderMessage(reminderID, channelID, messageID string) error {
+	return UpdateDoseLog(func(log *DoseLog) error {
+		for _, entry := range log.Reminder(reminderID) {
+			entry.ChannelID = channelID
+			entry.MessageID = messageID
+		}
+		return nil
+	})
+}
+
+// isOpen reports whether a dose still needs to be taken or skipped
+func (e DoseEntry) isOpen() bool {
+	return e.Status == DosePending || e.Status == DoseSnoozed
+}
+
+// entryMatches reports whether a logged dose is of the patient's named medication. Names
+// match ignoring case, and doses logged before patient profiles have no patient ID, so
+// those match any patient.
+func entryMatches(e DoseEntry, patientID, name string) bool {
+	return strings.EqualFold(e.Medication, name) && (e.Patient == "" || e.Patient == patientID)
+}
+
+// RecordDoseOutcome sets the status of every open dose in a reminder and returns the updated entries
+func RecordDoseOutcome(reminderID string, status DoseStatus, userID string, at time.Time) ([]DoseEntry, error) {
+	var updated []DoseEntry
+	err := UpdateDoseLog(func(log *DoseLog) error {
+		entries := log.Reminder(reminderID)
+		if len(entries) == 0 {
+			return fmt.Errorf("reminder %s not found", reminderID)
+		}
+
+		for _, entry := range entries {
+			if !entry.isOpen() {
+				continue
+			}
+			entry.Status = status
+			entry.ActedBy = userID
+			entry.ActedAt = at
+			entry.SnoozedUntil = time.Time{}
+			updated = append(updated, *entry)
+		}
+		return nil
+	})
+	return updated, err
+}
+
+// DoseButtonID builds the custom ID of a dose acknowledgement button
+func DoseButtonID(status DoseStatus, reminderID string) string {
+	return DoseButtonPrefix + ":" + string(status) + ":" + reminderID
+}
+
+// ReminderComponents returns the Taken/Skipped/Snooze buttons attached to a reminder
+func ReminderComponents(reminderID string) []discordgo.MessageComponent {
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.Button{
+					Label:    "Taken",
+					Style:    discordgo.SuccessButton,
+					Emoji:    &discordgo.ComponentEmoji{Name: "✅"},
+					CustomID: DoseButtonID(DoseTaken, reminderID),
+				},
+				discordgo.Button{
+					Label:    "Skipped",
+					Style:    discordgo.DangerButton,
+					Emoji:    &discordgo.ComponentEmoji{Name: "⏭️"},
+					CustomID: DoseButtonID(DoseSkipped, reminderID),
+				},
+				discordgo.Button{
+					Label:    "Snooze",
+					Style:    discordgo.SecondaryButton,
+					Emoji:    &discordgo.ComponentEmoji{Name: "💤"},
+					CustomID: DoseButtonID(DoseSnoozed, reminderID),
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,296 @@
+package common
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// EscalationPolicy describes what happens when a dose is not acknowledged.
+// Each step is measured from when the reminder was sent; a zero delay disables the step.
+type EscalationPolicy struct {
+	RemindAfter     int      `json:"remind_after_minutes,omitempty"`    // re-DM the patient
+	CaregiverAfter  int      `json:"caregiver_after_minutes,omitempty"` // notify caregivers
+	CaregiverIDs    []string `json:"caregiver_ids,omitempty"`           // Discord user IDs
+	EmailCaregivers bool     `json:"email_caregivers,omitempty"`        // also email the patient's email list
+	ChannelAfter    int      `json:"channel_after_minutes,omitempty"`   // post to a guild channel
+	ChannelID       string   `json:"channel_id,omitempty"`
+	// SetAt is when the policy was set, doses due before then aren't escalated
+	SetAt time.Time `json:"set_at,omitempty"`
+}
+
+// Escalation levels, in the order they are sent
+const (
+	EscalateRemind     = 1
+	EscalateCaregivers = 2
+	EscalateChannel    = 3
+)
+
+// delay returns how long after sending the reminder the given level fires
+func (p *EscalationPolicy) delay(level int) time.Duration {
+	switch level {
+	case EscalateRemind:
+		return time.Duration(p.RemindAfter) * time.Minute
+	case EscalateCaregivers:
+		if len(p.CaregiverIDs) == 0 && !p.EmailCaregivers {
+			return 0
+		}
+		return time.Duration(p.CaregiverAfter) * time.Minute
+	case EscalateChannel:
+		if p.ChannelID == "" {
+			return 0
+		}
+		return time.Duration(p.ChannelAfter) * time.Minute
+	}
+	return 0
+}
+
+// Enabled reports whether any level is enabled
+func (p *EscalationPolicy) Enabled() bool {
+	for level := EscalateRemind; level <= EscalateChannel; level++ {
+		if p.delay(level) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// String describes the enabled levels, e.g. "remind after 15 min, caregivers after 60 min"
+func (p EscalationPolicy) String() string {
+	var parts []string
+	if p.RemindAfter > 0 {
+		parts = append(parts, fmt.Sprintf("remind after %d min", p.RemindAfter))
+	}
+	if p.delay(EscalateCaregivers) > 0 {
+		parts = append(parts, fmt.Sprintf("caregivers after %d min", p.CaregiverAfter))
+	}
+	if p.delay(EscalateChannel) > 0 {
+		parts = append(parts, fmt.Sprintf("<#%s> after %d min", p.ChannelID, p.ChannelAfter))
+	}
+	if len(parts) == 0 {
+		return "off"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// escalates reports whether a dose of med is escalated. Inactive medications aren't, nor
+// are doses due before the policy was set, so adding a policy doesn't escalate old doses.
+func escalates(entry DoseEntry, med Medication) bool {
+	policy := med.Escalation
+	return med.Active && policy != nil && !entry.DueAt.Before(policy.SetAt)
+}
+
+// nextEscalation returns the next enabled level after the one already sent and when it is due
+func nextEscalation(entry DoseEntry, policy *EscalationPolicy) (int, time.Time, bool) {
+	if policy == nil || entry.Status != DosePending {
+		return 0, time.Time{}, false
+	}
+
+	for level := entry.EscalationLevel + 1; level <= EscalateChannel; level++ {
+		if d := policy.delay(level); d > 0 {
+			return level, entry.SentAt.Add(d), true
+		}
+	}
+	return 0, time.Time{}, false
+}
+
+// dueEscalation returns the last enabled level due at or before now. Levels that came due
+// together, e.g. while the bot was down, are sent once as the latest of them.
+func dueEscalation(entry DoseEntry, policy *EscalationPolicy, now time.Time) (int, bool) {
+	level, at, ok := nextEscalation(entry, policy)
+	if !ok || at.After(now) {
+		return 0, false
+	}
+	for next := level + 1; next <= EscalateChannel; next++ {
+		if d := policy.delay(next); d > 0 && !entry.SentAt.Add(d).After(now) {
+			level = next
+		}
+	}
+	return level, true
+}
+
+// NextEscalationTime returns when the earliest pending escalation is due
+func NextEscalationTime(schedule *MedicationSchedule, log *DoseLog) (time.Time, bool) {
+	var next time.Time
+	for _, entry := range log.Entries {
+		_, med, ok := findMedication(schedule, entry.Patient, entry.Medication)
+		if !ok || !escalates(entry, med) {
+			continue
+		}
+		if _, at, ok := nextEscalation(entry, med.Escalation); ok {
+			if next.IsZero() || at.Before(next) {
+				next = at
+			}
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// escalationGroup is one escalation message covering the doses of a reminder at the same level
+type escalationGroup struct {
+	patient     *Patient
+	reminderID  string
+	level       int
+	dueAt       time.Time
+	sentAt      time.Time
+	medications []Medication
+}
+
+// RunEscalations sends every escalation that is due at or before now
+func RunEscalations(sess *discordgo.Session, now time.Time) {
+	if sess == nil {
+		fmt.Println("Error: Discord session is nil")
+		return
+	}
+
+	schedule, err := LoadMedicationState()
+	if err != nil {
+		fmt.Printf("Error loading medication state: %v\n", err)
+		return
+	}
+
+	groups := make(map[string]*escalationGroup)
+	err = UpdateDoseLog(func(log *DoseLog) error {
+		for i := range log.Entries {
+			entry := &log.Entries[i]
+			patient, med, ok := findMedication(schedule, entry.Patient, entry.Medication)
+			if !ok || !escalates(*entry, med) {
+				continue
+			}
+
+			level, ok := dueEscalation(*entry, med.Escalation, now)
+			if !ok {
+				continue
+			}
+			entry.EscalationLevel = level
+
+			key := fmt.Sprintf("%s:%d", entry.ReminderID, level)
+			group, ok := groups[key]
+			if !ok {
+				group = &escalationGroup{
+					patient:    patient,
+					reminderID: entry.ReminderID,
+					level:      level,
+					dueAt:      entry.DueAt,
+					sentAt:     entry.SentAt,
+				}
+				groups[key] = group
+			}
+			group.medications = append(group.medications, med)
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("Error updating dose log: %v\n", err)
+		return
+	}
+
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		sendEscalation(sess, groups[key], now)
+	}
+}
+
+// sendEscalation delivers one escalation step to its recipients
+func sendEscalation(sess *discordgo.Session, group *escalationGroup, now time.Time) {
+	names := make([]string, 0, len(group.medications))
+	for _, med := range group.medications {
+		names = append(names, med.Name)
+	}
+	patient := group.patient
+	waited := int(now.Sub(group.sentAt).Minutes())
+	due := group.dueAt.In(patient.LocationAt(group.dueAt)).Format("15:04")
+	components := ReminderComponents(group.reminderID)
+
+	switch group.level {
+	case EscalateRemind:
+		msg := fmt.Sprintf("⏰ **Still waiting on %s's %s dose** ⏰\n\n", patient.Name, due)
+		msg += fmt.Sprintf("💊 %s\n\n", strings.Join(names, "\n💊 "))
+		msg += fmt.Sprintf("The reminder was sent %d minutes ago and hasn't been confirmed yet. Please tap a button below once it's done.", waited)
+
+		for _, userID := range patient.DiscordIDs {
+			go func(uid string) {
+				defer func() {
+					if r := recover(); r != nil {
+						fmt.Printf("Discord DM panic: %v\n", r)
+					}
+				}()
+				if _, err := sendDM(sess, uid, msg, components); err != nil {
+					fmt.Println(err)
+				} else {
+					fmt.Printf("Sent escalation reminder to user %s\n", uid)
+				}
+			}(userID)
+		}
+
+	case EscalateCaregivers:
+		msg := fmt.Sprintf("⚠️ **Unconfirmed dose** ⚠️\n\nNobody has confirmed %s's %s dose of:\n", patient.Name, due)
+		msg += fmt.Sprintf("💊 %s\n\n", strings.Join(names, "\n💊 "))
+		msg += fmt.Sprintf("The reminder was sent %d minutes ago. Please check in, and confirm below if the dose was given.", waited)
+
+		caregivers := make(map[string]bool)
+		email := false
+		for _, med := range group.medications {
+			for _, id := range med.Escalation.CaregiverIDs {
+				caregivers[id] = true
+			}
+			email = email || med.Escalation.EmailCaregivers
+		}
+
+		for id := range caregivers {
+			go func(uid string) {
+				defer func() {
+					if r := recover(); r != nil {
+						fmt.Printf("Discord DM panic: %v\n", r)
+					}
+				}()
+				if _, err := sendDM(sess, uid, msg, components); err != nil {
+					fmt.Println(err)
+				} else {
+					fmt.Printf("Sent escalation to caregiver %s\n", uid)
+				}
+			}(id)
+		}
+		if email {
+			sendEmailAsync(patient.Emails, "Unconfirmed Medication Dose", msg)
+		}
+
+	case EscalateChannel:
+		msg := fmt.Sprintf("🚨 **Missed dose alert** 🚨\n\nNobody has confirmed %s's %s dose:\n", patient.Name, due)
+		msg += fmt.Sprintf("💊 %s\n\n", strings.Join(names, "\n💊 "))
+		msg += fmt.Sprintf("The reminder was sent %d minutes ago. Anyone who gave the dose can confirm it below.", waited)
+
+		channels := make(map[string]bool)
+		for _, med := range group.medications {
+			if med.Escalation.ChannelID != "" {
+				channels[med.Escalation.ChannelID] = true
+			}
+		}
+
+		for channelID := range channels {
+			go func(cid string) {
+				defer func() {
+					if r := recover(); r != nil {
+						fmt.Printf("Channel message panic: %v\n", r)
+					}
+				}()
+				_, err := sess.ChannelMessageSendComplex(cid, &discordgo.MessageSend{
+					Content:    msg,
+					Components: components,
+				})
+				if err != nil {
+					fmt.Printf("Error posting escalation to channel %s: %v\n", cid, err)
+				} else {
+					fmt.Printf("Posted escalation to channel %s\n", cid)
+				}
+			}(channelID)
+		}
+	}
+}
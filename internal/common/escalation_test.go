@@ -0,0 +1,59 @@
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEscalatesOnlyCurrentDoses(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	policy := &EscalationPolicy{RemindAfter: 15, CaregiverAfter: 60, CaregiverIDs: []string{"1"}, SetAt: now.Add(-24 * time.Hour)}
+	med := Medication{Name: "A1", Active: true, Escalation: policy}
+	pending := func(sent time.Time) DoseEntry {
+		return DoseEntry{Patient: "a", Medication: "A1", DueAt: sent, SentAt: sent, Status: DosePending}
+	}
+
+	tests := []struct {
+		name  string
+		entry DoseEntry
+		med   Medication
+		want  bool
+	}{
+		{"pending", pending(now.Add(-70 * time.Minute)), med, true},
+		{"inactive", pending(now.Add(-70 * time.Minute)), Medication{Name: "A1", Escalation: policy}, false},
+		{"before the policy", pending(policy.SetAt.Add(-time.Minute)), med, false},
+		{"long past the last level", pending(now.Add(-3 * time.Hour)), med, true},
+	}
+	for _, tt := range tests {
+		if got := escalates(tt.entry, tt.med); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDueEscalationSendsOverdueLevelsOnce(t *testing.T) {
+	sent := time.Date(2026, 3, 10, 8, 0, 0, 0, time.UTC)
+	policy := &EscalationPolicy{RemindAfter: 15, CaregiverAfter: 60, CaregiverIDs: []string{"1"}, ChannelAfter: 120, ChannelID: "2"}
+	entry := DoseEntry{Patient: "a", Medication: "A1", DueAt: sent, SentAt: sent, Status: DosePending}
+
+	tests := []struct {
+		name      string
+		sentLevel int
+		now       time.Time
+		want      int
+		wantOK    bool
+	}{
+		{"not due yet", 0, sent.Add(10 * time.Minute), 0, false},
+		{"first level", 0, sent.Add(20 * time.Minute), EscalateRemind, true},
+		{"second level", EscalateRemind, sent.Add(70 * time.Minute), EscalateCaregivers, true},
+		{"all overdue", 0, sent.Add(5 * time.Hour), EscalateChannel, true},
+		{"all sent", EscalateChannel, sent.Add(5 * time.Hour), 0, false},
+	}
+	for _, tt := range tests {
+		e := entry
+		e.EscalationLevel = tt.sentLevel
+		if got, ok := dueEscalation(e, policy, tt.now); got != tt.want || ok != tt.wantOK {
+			t.Errorf("%s: got level %d (%v), want %d (%v)", tt.name, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package common
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IntervalSchedule doses a medication every few hours instead of at fixed times of day
+type IntervalSchedule struct {
+	EveryHours int `json:"every_hours"`
+	// Start is when the first dose is due; after a dose is confirmed taken the next
+	// one is due EveryHours after it was taken
+	Start time.Time `json:"start"`
+}
+
+// Every returns the time between doses
+func (s IntervalSchedule) Every() time.Duration {
+	return time.Duration(s.EveryHours) * time.Hour
+}
+
+// intervalPattern matches "every 8h", "every 8 hours" and "every 8h from 07:00"
+var intervalPattern = regexp.MustCompile(`(?i)^every\s+(\d+)\s*(?:h|hr|hrs|hour|hours)(?:\s+from\s+(\S+))?$`)
+
+// IsIntervalSpec reports whether a times value describes an interval rather than times of day
+func IsIntervalSpec(value string) bool {
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(value)), "every")
+}
+
+// ParseInterval parses "every 8h" or "every 8h from 07:00". Without a start time the
+// first reminder is one interval from now, as the first dose is usually given on the
+// spot. With one, the first dose is at that time today; if it already passed, that
+// dose is taken as given and reminders continue on the same grid.
+func ParseInterval(value string, now time.Time, loc *time.Location) (*IntervalSchedule, error) {
+	match := intervalPattern.FindStringSubmatch(strings.TrimSpace(value))
+	if match == nil {
+		return nil, fmt.Errorf("invalid interval %q, expected e.g. every 8h or every 8h from 07:00", value)
+	}
+
+	hours, err := strconv.Atoi(match[1])
+	if err != nil || hours < 1 || hours > 72 {
+		return nil, fmt.Errorf("interval must be between 1 and 72 hours")
+	}
+	schedule := &IntervalSchedule{EveryHours: hours}
+
+	if match[2] == "" {
+		schedule.Start = now.Add(schedule.Every()).Truncate(time.Minute)
+		return schedule, nil
+	}
+
+	hour, minute, err := ParseTimeOfDay(match[2])
+	if err != nil {
+		return nil, err
+	}
+	local := now.In(loc)
+	schedule.Start = LocalTime(local.Year(), local.Month(), local.Day(), hour, minute, loc)
+	for !schedule.Start.After(now) {
+		schedule.Start = schedule.Start.Add(schedule.Every())
+	}
+	return schedule, nil
+}
+
+// NextIntervalDose returns the first interval dose of a patient's medication due after
+// the given instant that hasn't been reminded yet. Doses are due EveryHours after the
+// last one confirmed taken, or on the grid from Start while none has been confirmed.
+func (m Medication) NextIntervalDose(patientID string, log *DoseLog, after time.Time) (time.Time, bool) {
+	if m.Interval == nil || m.Interval.EveryHours <= 0 || m.Interval.Start.IsZero() {
+		return time.Time{}, false
+	}
+	every := m.Interval.Every()
+
+	// The grid starts at Start, or one interval after the latest confirmed dose
+	base := m.Interval.Start
+	var lastSent time.Time
+	if log != nil {
+		for _, entry := range log.Entries {
+			if !entryMatches(entry, patientID, m.Name) {
+				continue
+			}
+			if entry.DueAt.After(lastSent) {
+				lastSent = entry.DueAt
+			}
+			if entry.Status == DoseTaken && entry.ActedAt.Add(every).After(base) {
+				base = entry.ActedAt.Add(every).Truncate(time.Minute)
+			}
+		}
+	}
+
+	// Skip doses that were already reminded, then find the first one after the given instant
+	if lastSent.After(after) {
+		after = lastSent
+	}
+	next := base
+	if !next.After(after) {
+		steps := after.Sub(next)/every + 1
+		next = next.Add(steps * every)
+	}
+	return next, true
+}
+
+// ScheduleText describes when a medication is taken, e.g. "08:00, 20:00" or "every 8h"
+func (m Medication) ScheduleText() string {
+	if m.PRN != nil {
+		return m.PRN.String()
+	}
+	if m.Interval != nil {
+		return fmt.Sprintf("every %dh", m.Interval.EveryHours)
+	}
+	return strings.Join(m.Times, ", ")
+}
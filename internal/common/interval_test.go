@@ -0,0 +1,65 @@
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseInterval(t *testing.T) {
+	now := time.Date(2026, 3, 10, 10, 30, 0, 0, time.UTC)
+	tests := []struct {
+		value     string
+		wantEvery int
+		wantStart time.Time
+		wantErr   bool
+	}{
+		{"every 8h", 8, time.Date(2026, 3, 10, 18, 30, 0, 0, time.UTC), false},
+		{"Every 6 hours", 6, time.Date(2026, 3, 10, 16, 30, 0, 0, time.UTC), false},
+		{"every 8h from 07:00", 8, time.Date(2026, 3, 10, 15, 0, 0, 0, time.UTC), false},
+		{"every 8h from 12:00", 8, time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC), false},
+		{"every 0h", 0, time.Time{}, true},
+		{"every 73h", 0, time.Time{}, true},
+		{"every 2 days", 0, time.Time{}, true},
+		{"every 8h from noon", 0, time.Time{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseInterval(tt.value, now, time.UTC)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%q: got %+v, want an error", tt.value, got)
+			}
+			continue
+		}
+		if err != nil || got.EveryHours != tt.wantEvery || !got.Start.Equal(tt.wantStart) {
+			t.Errorf("%q: got %+v (%v), want every %dh from %v", tt.value, got, err, tt.wantEvery, tt.wantStart)
+		}
+	}
+}
+
+func TestNextIntervalDose(t *testing.T) {
+	start := time.Date(2026, 3, 10, 7, 0, 0, 0, time.UTC)
+	due := time.Date(2026, 3, 10, 15, 0, 0, 0, time.UTC)
+	med := Medication{Name: "A1", Active: true, Interval: &IntervalSchedule{EveryHours: 8, Start: start}}
+	reminded := DoseEntry{Patient: "a", Medication: "A1", DueAt: due, SentAt: due, Status: DosePending}
+	taken := reminded
+	taken.Status, taken.ActedAt = DoseTaken, time.Date(2026, 3, 10, 17, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		log   *DoseLog
+		after time.Time
+		want  time.Time
+	}{
+		{"no doses yet", &DoseLog{}, start.Add(-time.Hour), start},
+		{"on the grid", &DoseLog{}, due, time.Date(2026, 3, 10, 23, 0, 0, 0, time.UTC)},
+		{"taken late", &DoseLog{Entries: []DoseEntry{taken}}, taken.ActedAt, time.Date(2026, 3, 11, 1, 0, 0, 0, time.UTC)},
+		{"pending", &DoseLog{Entries: []DoseEntry{reminded}}, due.Add(2 * time.Hour), time.Date(2026, 3, 10, 23, 0, 0, 0, time.UTC)},
+		{"pending, checked at the reminder", &DoseLog{Entries: []DoseEntry{reminded}}, due.Add(-time.Minute), time.Date(2026, 3, 10, 23, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, ok := med.NextIntervalDose("a", tt.log, tt.after)
+		if !ok || !got.Equal(tt.want) {
+			t.Errorf("%s: next dose at %v (%v), want %v", tt.name, got, ok, tt.want)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// settingsFile is where the JSON store keeps settings, alongside the medication state file
+const settingsFile = "settings.json"
+
+// JSONStore keeps the state, the dose log and the settings in one JSON file each, so
+// every change rewrites its whole file. Files are replaced atomically, and the last few
+// good versions are kept as backups to fall back on when a file can't be read.
+type JSONStore struct {
+	statePath    string
+	doseLogPath  string
+	settingsPath string
+	backups      int
+
+	// settingsMutex keeps settings saved at once from overwriting each other, the state
+	// and dose log are only ever written by the state service
+	settingsMutex sync.Mutex
+
+	failedMutex sync.Mutex
+	// failed maps files that couldn't be read or restored to the error already reported
+	failed map[string]string
+}
+
+// NewJSONStore returns a store writing to the given files, keeping backups previous
+// versions of each
+func NewJSONStore(statePath, doseLogPath, settingsPath string, backups int) *JSONStore {
+	return &JSONStore{
+		statePath:    statePath,
+		doseLogPath:  doseLogPath,
+		settingsPath: settingsPath,
+		backups:      backups,
+		failed:       make(map[string]string),
+	}
+}
+
+// LoadSchedule reads the state file as is, older layouts are upgraded by the caller
+func (s *JSONStore) LoadSchedule() (*MedicationSchedule, error) {
+	return readJSONWithBackups[MedicationSchedule](s, s.statePath)
+}
+
+// SaveSchedule writes the whole state file
+func (s *JSONStore) SaveSchedule(schedule *MedicationSchedule) error {
+	return s.writeJSON(s.statePath, schedule, s.backups)
+}
+
+// SaveScheduleChanges rewrites the state file with the changes made to it
+func (s *JSONStore) SaveScheduleChanges(changes *ScheduleChanges) error {
+	schedule, err := s.LoadSchedule()
+	if err != nil {
+		return err
+	}
+	if schedule == nil {
+		schedule = &MedicationSchedule{Patients: []Patient{}}
+	}
+	changes.apply(schedule)
+	return s.writeJSON(s.statePath, schedule, s.backups)
+}
+
+// LoadDoseLog reads the dose log file
+func (s *JSONStore) LoadDoseLog() (*DoseLog, error) {
+	log, err := readJSONWithBackups[DoseLog](s, s.doseLogPath)
+	if err != nil {
+		return nil, err
+	}
+	if log == nil {
+		return &DoseLog{}, nil
+	}
+	return log, nil
+}
+
+// SaveDoseChanges rewrites the dose log file with the changes made to it
+func (s *JSONStore) SaveDoseChanges(changes *DoseChanges) error {
+	log, err := s.LoadDoseLog()
+	if err != nil {
+		return err
+	}
+	if err := changes.apply(log); err != nil {
+		return err
+	}
+	return s.writeJSON(s.doseLogPath, log, s.backups)
+}
+
+// Setting returns the value saved under key, and whether one was
+func (s *JSONStore) Setting(key string) (string, bool, error) {
+	settings, err := s.settings()
+	if err != nil {
+		return "", false, err
+	}
+	value, ok := settings[key]
+	return value, ok, nil
+}
+
+// SetSetting rewrites the settings file with the value saved under key
+func (s *JSONStore) SetSetting(key, value string) error {
+	s.settingsMutex.Lock()
+	defer s.settingsMutex.Unlock()
+	settings, err := s.settings()
+	if err != nil {
+		return err
+	}
+	settings[key] = value
+	return s.writeJSON(s.settingsPath, settings, s.backups)
+}
+
+// settings reads every saved setting, none when the file was never written
+func (s *JSONStore) settings() (map[string]string, error) {
+	settings, err := readJSONWithBackups[map[string]string](s, s.settingsPath)
+	if err != nil {
+		return nil, err
+	}
+	if settings == nil || *settings == nil {
+		return make(map[string]string), nil
+	}
+	return *settings, nil
+}
+
+// Close does nothing, the files are closed after every read and write
+func (s *JSONStore) Close() error {
+	return nil
+}
+
+// writeJSON atomically writes v as indented JSON, the way the state files have always
+// looked, keeping the version it replaces as a backup
+func (s *JSONStore) writeJSON(path string, v any, backups int) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := rotateBackups(path, backups); err != nil {
+		// A missed backup is no reason to lose the change itself
+		fmt.Printf("Error backing up %s: %v\n", path, err)
+	}
+	return writeFileAtomic(path, data)
+}
+
+// readJSON reads a JSON file as is, or nil when it was never written. Unlike
+// readJSONWithBackups it never moves or restores anything.
+func readJSON[T any](path string) (*T, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var v T
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", path, err)
+	}
+	return &v, nil
+}
+
+// readJSONWithBackups reads a JSON file, or nil when it was never written. A file that
+// can't be read is moved aside and replaced by its newest backup that can, and the
+// admins are alerted either way.
+func readJSONWithBackups[T any](s *JSONStore, path string) (*T, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		var v T
+		if err = json.Unmarshal(data, &v); err == nil {
+			return &v, nil
+		}
+	}
+	missing := os.IsNotExist(err)
+	if missing {
+		if _, statErr := os.Stat(backupPath(path, 1)); os.IsNotExist(statErr) {
+			return nil, nil
+		}
+		// The file was never saved without the backups being written first, so it was deleted
+		err = fmt.Errorf("%s is missing but has backups", path)
+	}
+
+	recovery := StateRecovery{Path: path, Err: err, At: time.Now()}
+	for n := 1; n <= s.backups; n++ {
+		backup := backupPath(path, n)
+		data, readErr := os.ReadFile(backup)
+		if readErr != nil {
+			continue
+		}
+		var v T
+		if json.Unmarshal(data, &v) != nil {
+			continue
+		}
+
+		if !missing {
+			recovery.Moved = fmt.Sprintf("%s.corrupt-%s", path, recovery.At.Format("20060102-150405"))
+			if err := os.Rename(path, recovery.Moved); err != nil {
+				return nil, fmt.Errorf("error moving unreadable %s aside: %w", path, err)
+			}
+		}
+		if err := writeFileAtomic(path, data); err != nil {
+			return nil, fmt.Errorf("error restoring %s from %s: %w", path, backup, err)
+		}
+		recovery.Backup = backup
+		s.clearFailed(path)
+		reportRecovery(recovery)
+		return &v, nil
+	}
+
+	// Without a backup to go back to, the file is left alone for someone to fix, and
+	// reported once rather than on every load
+	if s.markFailed(path, err) {
+		reportRecovery(recovery)
+	}
+	return nil, fmt.Errorf("error reading %s, and no backup could be read: %w", path, err)
+}
+
+// markFailed remembers that a file couldn't be read and reports whether this error is new
+func (s *JSONStore) markFailed(path string, err error) bool {
+	s.failedMutex.Lock()
+	defer s.failedMutex.Unlock()
+	if s.failed[path] == err.Error() {
+		return false
+	}
+	s.failed[path] = err.Error()
+	return true
+}
+
+// clearFailed forgets that a file couldn't be read, once it was restored
+func (s *JSONStore) clearFailed(path string) {
+	s.failedMutex.Lock()
+	defer s.failedMutex.Unlock()
+	delete(s.failed, path)
+}
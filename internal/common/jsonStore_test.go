@@ -0,0 +1,77 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// takeRecoveries returns the recoveries reported while no handler was registered
+func takeRecoveries() []StateRecovery {
+	recoveryMutex.Lock()
+	defer recoveryMutex.Unlock()
+	taken := pendingRecoveries
+	pendingRecoveries = nil
+	return taken
+}
+
+func TestCorruptStateFileIsRestoredFromBackup(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, stateFile)
+	store := NewJSONStore(path, filepath.Join(dir, doseLogFile), filepath.Join(dir, settingsFile), 2)
+	takeRecoveries()
+
+	saved := &MedicationSchedule{Version: SchemaVersion, Patients: []Patient{{ID: "a", Name: "A"}}}
+	if err := store.SaveSchedule(saved); err != nil {
+		t.Fatal(err)
+	}
+	saved.Patients = append(saved.Patients, Patient{ID: "b", Name: "B"})
+	if err := store.SaveSchedule(saved); err != nil {
+		t.Fatal(err)
+	}
+	backup, err := os.ReadFile(backupPath(path, 1))
+	if err != nil {
+		t.Fatalf("the first save wasn't kept as a backup: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(`{"version":`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	schedule, err := store.LoadSchedule()
+	if err != nil {
+		t.Fatalf("loading: %v", err)
+	}
+	if len(schedule.Patients) != 1 || schedule.Patients[0].ID != "a" {
+		t.Errorf("got patients %+v, want the backup's", schedule.Patients)
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != string(backup) {
+		t.Errorf("the state file holds %s (%v), want the backup", data, err)
+	}
+
+	var moved []string
+	for _, name := range listDir(t, dir) {
+		if strings.HasPrefix(name, stateFile+".corrupt-") {
+			moved = append(moved, name)
+		}
+	}
+	if len(moved) != 1 {
+		t.Fatalf("got %v moved aside, want the corrupt file", moved)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, moved[0])); err != nil || string(data) != `{"version":` {
+		t.Errorf("moved %s holds %s (%v), want the corrupt file", moved[0], data, err)
+	}
+
+	recoveries := takeRecoveries()
+	if len(recoveries) != 1 || recoveries[0].Backup != backupPath(path, 1) || recoveries[0].Moved != filepath.Join(dir, moved[0]) {
+		t.Errorf("got recoveries %+v, want one from the first backup", recoveries)
+	}
+
+	// The restored file loads as is
+	if _, err := store.LoadSchedule(); err != nil {
+		t.Errorf("loading again: %v", err)
+	}
+	if recoveries := takeRecoveries(); len(recoveries) != 0 {
+		t.Errorf("loading the restored file reported %+v", recoveries)
+	}
+}
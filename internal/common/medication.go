@@ -1,239 +1,226 @@
 package common
 
 import (
-	"encoding/json"
 	"fmt"
-	"os"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
 
 // Medication represents a single medication with its schedule
 type Medication struct {
-	Name           string   `json:"name"`
-	Dose           string   `json:"dose"`
-	Times          []string `json:"times"` // e.g., ["06:00", "18:00"]
-	DaysRemaining  int      `json:"days_remaining"`
-	TotalDays      int      `json:"total_days"`
-	Indication     string   `json:"indication"`
-	Notes          string   `json:"notes,omitempty"`
-	Active         bool     `json:"active"`
-	StartDate      string   `json:"start_date"` // YYYY-MM-DD format
+	Name          string            `json:"name"`
+	Dose          Dose              `json:"dose"`
+	Times         []string          `json:"times"` // e.g., ["06:00", "18:00"]
+	DaysRemaining int               `json:"days_remaining"`
+	TotalDays     int               `json:"total_days"`
+	Indication    string            `json:"indication"`
+	Notes         string            `json:"notes,omitempty"`
+	Active        bool              `json:"active"`
+	Start         time.Time         `json:"start"` // first moment of the course, doses before it are skipped
+	Escalation    *EscalationPolicy `json:"escalation,omitempty"`
+	// DosesRemaining counts the doses still to come in a course with a set length
+	DosesRemaining int `json:"doses_remaining,omitempty"`
+	// TotalDoses sets the course length in doses instead of days, e.g. 14 tablets
+	TotalDoses int `json:"total_doses,omitempty"`
+	// Stock tracks the supply on hand, for refill alerts
+	Stock *Stock `json:"stock,omitempty"`
+	// StartDate is the YYYY-MM-DD start of older state files, moved into Start on load
+	StartDate string `json:"start_date,omitempty"`
+	// Phases replace Times and Dose day by day for tapering regimens, see OnDay
+	Phases []Phase `json:"phases,omitempty"`
+	// Interval doses every few hours instead of at Times, see NextIntervalDose
+	Interval *IntervalSchedule `json:"interval,omitempty"`
+	// PRN marks a medication taken only when needed, recorded with /took instead of reminded
+	PRN *PRNRule `json:"prn,omitempty"`
+	// Recurrence limits the days the medication is taken on, every day when nil
+	Recurrence *Recurrence `json:"recurrence,omitempty"`
+	// MgPerKg prescribes the dose by the patient's weight, recomputed on each weighing, see WeightDose
+	MgPerKg float64 `json:"mg_per_kg,omitempty"`
+	// Concentration is the mg per ml of a liquid, read from the name when not set
+	Concentration *Concentration `json:"concentration,omitempty"`
 }
 
-// MedicationSchedule holds all medications and their states
+// MedicationSchedule holds every patient with their medications and states
 type MedicationSchedule struct {
-	Medications      []Medication `json:"medications"`
-	LastUpdated      string       `json:"last_updated"`
-	PrednisoneSwitch bool         `json:"prednisone_switch"` // true when switched to 1x/day
+	// Version is the SchemaVersion the schedule was saved with, 0 before versions were saved
+	Version     int       `json:"version"`
+	Patients    []Patient `json:"patients"`
+	LastUpdated string    `json:"last_updated"`
+
+	// Single-patient fields from before patient profiles, moved into Patients on load
+	Medications []Medication      `json:"medications,omitempty"`
+	LastFired   map[string]string `json:"last_fired,omitempty"`
+	// PrednisoneSwitch marked the hardcoded Prednisone taper as done, replaced by phases on load
+	PrednisoneSwitch bool `json:"prednisone_switch,omitempty"`
 }
 
+// stateFile is where the JSON store keeps the medication state
 const stateFile = "medication_state.json"
 
-var stateMutex sync.Mutex
+var (
+	stateListenersMutex sync.Mutex
+	stateListeners      []func()
+)
 
-// LoadMedicationState loads the medication state from file
-func LoadMedicationState() (*MedicationSchedule, error) {
-	stateMutex.Lock()
-	defer stateMutex.Unlock()
+// OnStateChange registers a callback that runs after the medication state or dose log is saved
+func OnStateChange(fn func()) {
+	stateListenersMutex.Lock()
+	defer stateListenersMutex.Unlock()
+	stateListeners = append(stateListeners, fn)
+}
 
-	data, err := os.ReadFile(stateFile)
-	if err != nil {
-		if os.IsNotExist(err) {
-			// Initialize with default schedule if file doesn't exist
-			// Unlock before calling init to avoid deadlock
-			stateMutex.Unlock()
-			schedule := initializeDefaultSchedule()
-			stateMutex.Lock()
-			return schedule, nil
-		}
-		return nil, err
-	}
+// notifyStateChange calls every registered state change callback
+func notifyStateChange() {
+	stateListenersMutex.Lock()
+	listeners := append([]func(){}, stateListeners...)
+	stateListenersMutex.Unlock()
 
-	var schedule MedicationSchedule
-	if err := json.Unmarshal(data, &schedule); err != nil {
-		return nil, err
+	for _, fn := range listeners {
+		fn()
 	}
-
-	return &schedule, nil
 }
 
-// SaveMedicationState saves the medication state to file
-func SaveMedicationState(schedule *MedicationSchedule) error {
-	stateMutex.Lock()
-	defer stateMutex.Unlock()
-
-	schedule.LastUpdated = time.Now().Format(time.RFC3339)
-	data, err := json.MarshalIndent(schedule, "", "  ")
-	if err != nil {
-		return err
-	}
-	return os.WriteFile(stateFile, data, 0644)
+// LoadMedicationState returns a copy of the medication state to read. Changes to it
+// aren't saved, make them through UpdateMedicationState.
+func LoadMedicationState() (*MedicationSchedule, error) {
+	return states.Snapshot()
 }
 
-// Hardcoded user credentials for JP's medication reminders
-const (
-	JPDiscordID = "982491279369830460"
-	JPEmails    = "jpmercado57123@gmail.com,kingbluetoothz24@gmail.com,jplovesraw@gmail.com,jpmercado57@yahoo.com"
-)
+// UpdateMedicationState changes the medication state as one transaction: fn gets its own
+// copy, which is saved when fn returns nil and dropped otherwise
+func UpdateMedicationState(fn func(schedule *MedicationSchedule) error) error {
+	return states.Update(fn)
+}
 
-// initializeDefaultSchedule creates the initial medication schedule
-func initializeDefaultSchedule() *MedicationSchedule {
-	startDate := "2025-12-11" // Started December 11, 2025 at 6pm
-
-	schedule := &MedicationSchedule{
-		LastUpdated:      time.Now().Format(time.RFC3339),
-		PrednisoneSwitch: false,
-		Medications: []Medication{
-			{
-				Name:          "Doxycycline Hydrochloride 50mg/ml (EHRLICURE)",
-				Dose:          "2 ml",
-				Times:         []string{"18:00"}, // 6pm
-				DaysRemaining: 28,
-				TotalDays:     28,
-				Indication:    "Antibacterial",
-				Active:        true,
-				StartDate:     startDate,
-			},
-			{
-				Name:          "Prednisone 20mg tab",
-				Dose:          "1/2 tab",
-				Times:         []string{"09:00", "21:00"}, // 9am, 9pm
-				DaysRemaining: 7,
-				TotalDays:     7,
-				Indication:    "Corticosteroid",
-				Notes:         "After 7 days, switch to 9pm only",
-				Active:        true,
-				StartDate:     startDate,
-			},
-			{
-				Name:          "Papi Bion Plus",
-				Dose:          "1.5 ml",
-				Times:         []string{"13:00"}, // 1pm
-				DaysRemaining: 30,
-				TotalDays:     30,
-				Indication:    "Blood supplement",
-				Notes:         "Don't combine with Doxycycline on short intervals",
-				Active:        true,
-				StartDate:     startDate,
-			},
-			{
-				Name:          "Thromb Beat",
-				Dose:          "4 ml",
-				Times:         []string{"08:00", "20:00"}, // 8am, 8pm
-				DaysRemaining: 30,
-				TotalDays:     30,
-				Indication:    "Platelet supplement",
-				Active:        true,
-				StartDate:     startDate,
-			},
-			{
-				Name:          "Immunol syrup",
-				Dose:          "2 ml",
-				Times:         []string{"07:00", "19:00"}, // 7am, 7pm
-				DaysRemaining: 30,
-				TotalDays:     30,
-				Indication:    "Immune booster",
-				Active:        true,
-				StartDate:     startDate,
-			},
-			{
-				Name:          "Livertel",
-				Dose:          "3 ml",
-				Times:         []string{"07:15", "19:15"}, // 7:15am, 7:15pm
-				DaysRemaining: 15,
-				TotalDays:     15,
-				Indication:    "Liver supplement",
-				Active:        true,
-				StartDate:     startDate,
-			},
-			{
-				Name:          "Sync Nephric syrup",
-				Dose:          "3 ml",
-				Times:         []string{"07:30", "19:30"}, // 7:30am, 7:30pm
-				DaysRemaining: 15,
-				TotalDays:     15,
-				Indication:    "Kidney supplement",
-				Active:        true,
-				StartDate:     startDate,
-			},
-		},
+// initializeDefaultSchedule creates the schedule used when nothing was saved yet: the
+// configured seed file, or no patients until /setup adds the first one
+func initializeDefaultSchedule() (*MedicationSchedule, error) {
+	schedule := &MedicationSchedule{Patients: []Patient{}}
+	if seedFile != "" {
+		seeded, err := LoadSeedFile(seedFile)
+		if err != nil {
+			return nil, err
+		}
+		schedule = seeded
+		fmt.Printf("Seeded the medication schedule with %d patient(s) from %s\n", len(schedule.Patients), seedFile)
 	}
-
-	// Save the initial state
-	if err := SaveMedicationState(schedule); err != nil {
-		fmt.Printf("Warning: failed to save initial medication state: %v\n", err)
+	if simple := legacySimplePatient(); simple != nil && schedule.Patient(simple.ID) == nil {
+		schedule.Patients = append(schedule.Patients, *simple)
+	}
+	for _, change := range assignDefaultGuild(schedule) {
+		fmt.Println("Medication state: " + change)
 	}
 
-	return schedule
+	schedule.Version = SchemaVersion
+	schedule.LastUpdated = time.Now().Format(time.RFC3339)
+	return schedule, nil
 }
 
-// UpdateMedicationCounts updates the day counts based on elapsed days
-func UpdateMedicationCounts(schedule *MedicationSchedule) {
-	loc := time.FixedZone("UTC+8", 8*3600)
-	now := time.Now().In(loc)
-	today := now.Format("2006-01-02")
-
-	// Check if we already updated today
-	if schedule.LastUpdated != "" {
-		lastUpdate, err := time.Parse(time.RFC3339, schedule.LastUpdated)
-		if err == nil {
-			lastUpdateDay := lastUpdate.In(loc).Format("2006-01-02")
-			if lastUpdateDay == today {
-				return // Already updated today
-			}
+// UpdateMedicationCounts updates the days and doses left from the schedule and the dose
+// log, in each patient's own timezone, and reports whether any of them changed
+func UpdateMedicationCounts(schedule *MedicationSchedule, doseLog *DoseLog) bool {
+	changed := false
+	for p := range schedule.Patients {
+		if updatePatientCounts(&schedule.Patients[p], doseLog) {
+			changed = true
 		}
 	}
+	return changed
+}
 
-	for i := range schedule.Medications {
-		med := &schedule.Medications[i]
-		if !med.Active {
-			continue
+// RefreshMedicationCounts recounts every course right away and saves the counts that
+// changed, so one that just had its last dose confirmed ends without waiting for the
+// next reminder
+func RefreshMedicationCounts() {
+	doseLog, err := LoadDoseLog()
+	if err != nil {
+		fmt.Printf("Error loading dose log: %v\n", err)
+	}
+	err = UpdateMedicationState(func(schedule *MedicationSchedule) error {
+		if !UpdateMedicationCounts(schedule, doseLog) {
+			return ErrNoChanges
 		}
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("Error saving medication state: %v\n", err)
+	}
+}
 
-		startDate, err := time.Parse("2006-01-02", med.StartDate)
-		if err != nil {
-			fmt.Printf("Error parsing start date for %s: %v\n", med.Name, err)
+// updatePatientCounts updates the counts of one patient's medications and reports whether any changed
+func updatePatientCounts(patient *Patient, doseLog *DoseLog) bool {
+	now := time.Now()
+
+	changed := false
+	for i := range patient.Medications {
+		med := &patient.Medications[i]
+		if !med.Active || (med.TotalDays <= 0 && med.TotalDoses <= 0) {
+			// A course without a length runs until it is removed
 			continue
 		}
 
-		// Calculate days elapsed since start
-		daysElapsed := int(now.Sub(startDate).Hours() / 24)
-		
-		// Update days remaining
-		med.DaysRemaining = med.TotalDays - daysElapsed
-		
-		if med.DaysRemaining <= 0 {
-			med.Active = false
-			med.DaysRemaining = 0
+		before := *med
+		med.UpdateRemaining(patient.ID, doseLog, now, patient.LocationAt)
+		if med.DaysRemaining != before.DaysRemaining || med.DosesRemaining != before.DosesRemaining || med.Active != before.Active {
+			changed = true
 		}
+	}
+	return changed
+}
 
-		// Special handling for Prednisone: switch to 1x/day after 7 days
-		if med.Name == "Prednisone 20mg tab" && daysElapsed >= 7 && !schedule.PrednisoneSwitch {
-			med.Times = []string{"21:00"} // Switch to 9pm only
-			schedule.PrednisoneSwitch = true
-			fmt.Println("Prednisone switched to 1x per day (9pm only)")
+// ParseTimes parses a comma separated list of "15:04" times into sorted, de-duplicated values
+func ParseTimes(value string) ([]string, error) {
+	seen := make(map[string]bool)
+	var times []string
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		hour, minute, err := ParseTimeOfDay(part)
+		if err != nil {
+			return nil, err
+		}
+		t := fmt.Sprintf("%02d:%02d", hour, minute)
+		if !seen[t] {
+			seen[t] = true
+			times = append(times, t)
 		}
 	}
 
-	SaveMedicationState(schedule)
+	if len(times) == 0 {
+		return nil, fmt.Errorf("at least one time is required, e.g. 08:00, 20:00")
+	}
+	sort.Strings(times)
+	return times, nil
 }
 
-// GetCurrentReminders returns the list of medications due at or around the given time
-func GetCurrentReminders(schedule *MedicationSchedule, currentTime time.Time) []Medication {
-	loc := time.FixedZone("UTC+8", 8*3600)
-	now := currentTime.In(loc)
-	currentHour := now.Format("15:04")
+// GetCurrentReminders returns the patient's medications due at the given time. The dose
+// log places interval doses; without it only medications with fixed times are returned.
+// Due times are compared as instants, so doses moved by a DST jump are still found.
+func GetCurrentReminders(patient *Patient, doseLog *DoseLog, currentTime time.Time) []Medication {
+	minute := currentTime.Truncate(time.Minute)
 
 	var reminders []Medication
-	for _, med := range schedule.Medications {
-		if !med.Active {
+	for _, med := range patient.Medications {
+		if !med.Active || med.PRN != nil {
 			continue
 		}
 
-		for _, medTime := range med.Times {
-			if medTime == currentHour {
+		if med.Interval != nil {
+			if due, ok := med.NextIntervalDose(patient.ID, doseLog, minute.Add(-time.Minute)); ok && due.Equal(minute) {
 				reminders = append(reminders, med)
+			}
+			continue
+		}
+
+		// Phased medications are reminded with the times and dose of today's phase
+		for _, at := range med.dosesOn(minute, patient.LocationAt) {
+			if at.Equal(minute) {
+				reminders = append(reminders, med.OnDay(minute, patient.LocationAt))
 				break
 			}
 		}
@@ -242,20 +229,69 @@ func GetCurrentReminders(schedule *MedicationSchedule, currentTime time.Time) []
 	return reminders
 }
 
+// ParseTimeOfDay parses a "15:04" time string into hour and minute
+func ParseTimeOfDay(value string) (hour, minute int, err error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	return t.Hour(), t.Minute(), nil
+}
+
+// NextOccurrence returns the first instant strictly after now that matches the "15:04"
+// time of day, in the timezone of the day it falls on
+func NextOccurrence(value string, now time.Time, zone Locator) (time.Time, error) {
+	hour, minute, err := ParseTimeOfDay(value)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	loc := zone(now)
+	local := now.In(loc)
+	next := LocalTime(local.Year(), local.Month(), local.Day(), hour, minute, loc)
+	if !next.After(local) {
+		tomorrow := time.Date(local.Year(), local.Month(), local.Day()+1, 12, 0, 0, 0, loc)
+		next = LocalTime(local.Year(), local.Month(), local.Day()+1, hour, minute, zone(tomorrow))
+	}
+	return next, nil
+}
+
+// PreviousOccurrence returns the latest instant at or before now that matches the "15:04" time of day
+func PreviousOccurrence(value string, now time.Time, loc *time.Location) (time.Time, error) {
+	hour, minute, err := ParseTimeOfDay(value)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	local := now.In(loc)
+	prev := LocalTime(local.Year(), local.Month(), local.Day(), hour, minute, loc)
+	if prev.After(local) {
+		prev = LocalTime(local.Year(), local.Month(), local.Day()-1, hour, minute, loc)
+	}
+	return prev, nil
+}
+
 // FormatReminderMessage creates a formatted reminder message
-func FormatReminderMessage(reminders []Medication) string {
+func FormatReminderMessage(patient *Patient, reminders []Medication) string {
 	if len(reminders) == 0 {
 		return ""
 	}
 
 	message := "🔔 **Medication Reminder** 🔔\n\n"
-	message += "It's time for Diluc's meds! 💊✨\n\n"
+	message += patient.Greeting() + "\n\n"
 
 	for _, med := range reminders {
 		message += fmt.Sprintf("💊 **%s**\n", med.Name)
 		message += fmt.Sprintf("   📏 Dose: %s\n", med.Dose)
+		if basis := med.WeightBasis(patient); basis != "" {
+			message += fmt.Sprintf("   ⚖️ By weight: %s\n", basis)
+		}
 		message += fmt.Sprintf("   🏥 Purpose: %s\n", med.Indication)
-		message += fmt.Sprintf("   📅 Days remaining: %d/%d\n", med.DaysRemaining, med.TotalDays)
+		if med.TotalDoses > 0 {
+			message += fmt.Sprintf("   📅 Dose %d of %d\n", med.TotalDoses-med.DosesRemaining+1, med.TotalDoses)
+		} else if med.TotalDays > 0 {
+			message += fmt.Sprintf("   📅 Remaining: %s\n", med.RemainingText())
+		}
 		if med.Notes != "" {
 			message += fmt.Sprintf("   ℹ️ Note: %s\n", med.Notes)
 		}
@@ -268,28 +304,52 @@ func FormatReminderMessage(reminders []Medication) string {
 	return message
 }
 
-// GetAllActiveMedications returns a summary of all active medications
-func GetAllActiveMedications(schedule *MedicationSchedule) string {
-	message := "📋 **Current Medication Schedule** 📋\n\n"
+// GetAllActiveMedications returns a summary of the patient's active medications
+func GetAllActiveMedications(patient *Patient) string {
+	message := fmt.Sprintf("📋 **Current Medication Schedule — %s** 📋\n\n", patient.Name)
+	now := time.Now()
 
-	for _, med := range schedule.Medications {
-		if !med.Active {
+	if patient.Travel != nil {
+		message += FormatTravelPlan(patient) + "\n"
+	}
+	if len(patient.SimpleReminderTimes) > 0 {
+		message += fmt.Sprintf("🔔 Daily reminder at %s\n\n", strings.Join(patient.SimpleReminderTimes, ", "))
+	}
+
+	for _, phased := range patient.Medications {
+		if !phased.Active {
 			continue
 		}
+		med := phased.OnDay(now, patient.LocationAt)
 
-		timesStr := ""
-		for i, t := range med.Times {
-			if i > 0 {
-				timesStr += ", "
-			}
-			timesStr += t
-		}
+		timesStr := med.ScheduleText()
 
 		message += fmt.Sprintf("💊 **%s**\n", med.Name)
-		message += fmt.Sprintf("   📏 Dose: %s\n", med.Dose)
+		message += fmt.Sprintf("   📏 Dose: %s\n", med.DoseText())
+		if basis := med.WeightBasis(patient); basis != "" {
+			message += fmt.Sprintf("   ⚖️ By weight: %s\n", basis)
+		}
+		if timesStr == "" {
+			timesStr = "none today"
+		}
 		message += fmt.Sprintf("   ⏰ Times: %s\n", timesStr)
 		message += fmt.Sprintf("   🏥 Purpose: %s\n", med.Indication)
-		message += fmt.Sprintf("   📅 Days remaining: %d/%d\n", med.DaysRemaining, med.TotalDays)
+		if med.TotalDays > 0 || med.TotalDoses > 0 {
+			message += fmt.Sprintf("   📅 Remaining: %s\n", med.RemainingText())
+		}
+		if med.Recurrence != nil {
+			message += fmt.Sprintf("   🗓️ Repeats: %s\n", med.Recurrence)
+			// Today's copy has no times on days off, the next dose comes from the full schedule
+			if next, ok := phased.NextDoseTime(now, patient.LocationAt); ok {
+				message += fmt.Sprintf("   ⏭️ Next dose: %s\n", next.In(patient.LocationAt(next)).Format("Mon, Jan 2 15:04"))
+			}
+		}
+		if len(med.Phases) > 0 {
+			if day, err := med.CourseDay(now, patient.LocationAt); err == nil {
+				message += fmt.Sprintf("   📉 Day %d of taper:\n", day)
+				message += indent(FormatPhases(phased, day), "      ") + "\n"
+			}
+		}
 		if med.Notes != "" {
 			message += fmt.Sprintf("   ℹ️ Note: %s\n", med.Notes)
 		}
@@ -298,3 +358,8 @@ func GetAllActiveMedications(schedule *MedicationSchedule) string {
 
 	return message
 }
+
+// indent prefixes every line of text
+func indent(text, prefix string) string {
+	return prefix + strings.ReplaceAll(text, "\n", "\n"+prefix)
+}
@@ -0,0 +1,145 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SchemaVersion is the version of the medication state this build reads and writes.
+// Bump it with a new migration whenever a change needs older state upgraded.
+const SchemaVersion = 4
+
+// migration upgrades the schedule from the version before it to version, describing
+// every change it made
+type migration struct {
+	version int
+	name    string
+	apply   func(schedule *MedicationSchedule) []string
+}
+
+// migrations run in order on any state older than their version. State files from
+// before versions were saved count as version 0, so every step must leave state that
+// is already up to date alone.
+var migrations = []migration{
+	{1, "patient profiles", upgradeLegacySchedule},
+	{2, "Prednisone switch to phases", upgradePrednisoneSwitch},
+	{3, "start dates to start times", upgradeStartDates},
+	{4, "patients to servers", assignDefaultGuild},
+}
+
+// MigrationStep is what one migration changed
+type MigrationStep struct {
+	Version int
+	Name    string
+	Changes []string
+}
+
+// MigrationReport describes a migration from one schema version to another
+type MigrationReport struct {
+	From  int
+	To    int
+	Steps []MigrationStep
+}
+
+// Migrated reports whether the schedule was older than this build
+func (r *MigrationReport) Migrated() bool {
+	return r.From < r.To
+}
+
+// Changed reports whether any step changed the schedule beyond its version
+func (r *MigrationReport) Changed() bool {
+	for _, step := range r.Steps {
+		if len(step.Changes) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// String lists every step with its changes
+func (r *MigrationReport) String() string {
+	if !r.Migrated() {
+		return fmt.Sprintf("Medication state is at schema version %d, nothing to migrate", r.To)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Medication state migrates from schema version %d to %d", r.From, r.To)
+	for _, step := range r.Steps {
+		fmt.Fprintf(&b, "\n%d. %s", step.Version, step.Name)
+		if len(step.Changes) == 0 {
+			b.WriteString(": no changes")
+		}
+		for _, change := range step.Changes {
+			fmt.Fprintf(&b, "\n   - %s", change)
+		}
+	}
+	return b.String()
+}
+
+// MigrateSchedule runs every migration newer than the schedule's version on it and
+// sets it to SchemaVersion. State from a newer build is refused rather than loaded
+// with whatever this build doesn't know about dropped.
+func MigrateSchedule(schedule *MedicationSchedule) (*MigrationReport, error) {
+	report := &MigrationReport{From: schedule.Version, To: SchemaVersion}
+	if schedule.Version > SchemaVersion {
+		return nil, fmt.Errorf("medication state is schema version %d but this build only knows up to %d, update the bot instead", schedule.Version, SchemaVersion)
+	}
+
+	for _, m := range migrations {
+		if m.version <= schedule.Version {
+			continue
+		}
+		report.Steps = append(report.Steps, MigrationStep{Version: m.version, Name: m.name, Changes: m.apply(schedule)})
+	}
+	schedule.Version = SchemaVersion
+	return report, nil
+}
+
+// migrateLoaded migrates a schedule just loaded from a store, printing what changed
+func migrateLoaded(schedule *MedicationSchedule) (bool, error) {
+	report, err := MigrateSchedule(schedule)
+	if err != nil {
+		return false, err
+	}
+	if report.Migrated() {
+		fmt.Println(report)
+	}
+
+	// Patients left without a server when they were migrated get one once it's configured
+	if !report.Migrated() && defaultGuildID != "" {
+		if changes := assignDefaultGuild(schedule); len(changes) > 0 {
+			fmt.Printf("Medication state: %s\n", strings.Join(changes, ", "))
+			return true, nil
+		}
+	}
+	return report.Migrated(), nil
+}
+
+// DryRunMigration shows what loading the configured storage would migrate without
+// changing anything on disk: the database is opened read-only and must exist, and state
+// files that can't be read are reported instead of restored from their backups. A
+// database that is still empty reports on the JSON files it would import.
+func DryRunMigration(kind, path string) (*MigrationReport, error) {
+	var schedule *MedicationSchedule
+	if strings.EqualFold(strings.TrimSpace(kind), StorageSQLite) {
+		db, err := openSQLiteReadOnly(path)
+		if err != nil {
+			return nil, err
+		}
+		defer db.Close()
+		if schedule, err = db.LoadSchedule(); err != nil {
+			return nil, err
+		}
+	}
+	if schedule == nil {
+		var err error
+		if schedule, err = readJSON[MedicationSchedule](stateFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if schedule == nil {
+		return &MigrationReport{From: SchemaVersion, To: SchemaVersion}, nil
+	}
+	return MigrateSchedule(schedule)
+}
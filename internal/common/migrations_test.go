@@ -0,0 +1,138 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// inTempDir runs the test in a fresh directory, where the default state files are
+func inTempDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	return dir
+}
+
+// listDir names every file in dir
+func listDir(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+func TestDryRunMigrationReportsWithoutSaving(t *testing.T) {
+	dir := inTempDir(t)
+	legacy := `{"medications":[{"name":"Prednisone 20mg tab","dose":"1 tab","times":["09:00","21:00"],"active":true}],"prednisone_switch":true}`
+	if err := os.WriteFile(stateFile, []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := DryRunMigration(StorageJSON, "")
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if report.From != 0 || report.To != SchemaVersion || !report.Changed() {
+		t.Errorf("got %+v, want changes from version 0", report)
+	}
+	data, err := os.ReadFile(stateFile)
+	if err != nil || string(data) != legacy {
+		t.Errorf("dry run changed the state file to %s (%v)", data, err)
+	}
+	if files := listDir(t, dir); len(files) != 1 {
+		t.Errorf("dry run left %v", files)
+	}
+}
+
+func TestDryRunMigrationLeavesUnreadableFiles(t *testing.T) {
+	dir := inTempDir(t)
+	if err := os.WriteFile(stateFile, []byte("{broken"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(backupPath(stateFile, 1), []byte(`{"version":3,"patients":[]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := DryRunMigration(StorageJSON, ""); err == nil {
+		t.Errorf("dry run of an unreadable state file succeeded")
+	}
+	data, _ := os.ReadFile(stateFile)
+	if string(data) != "{broken" {
+		t.Errorf("dry run restored the state file to %s", data)
+	}
+	if files := listDir(t, dir); len(files) != 2 {
+		t.Errorf("dry run left %v", files)
+	}
+}
+
+func TestDryRunMigrationNeedsExistingDatabase(t *testing.T) {
+	dir := inTempDir(t)
+	path := filepath.Join(dir, "missing.db")
+	if _, err := DryRunMigration(StorageSQLite, path); err == nil {
+		t.Errorf("dry run of a missing database succeeded")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("dry run created the database")
+	}
+
+	db, err := OpenSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SaveSchedule(&MedicationSchedule{Version: SchemaVersion, Patients: []Patient{{ID: "a", Name: "A"}}}); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	before := listDir(t, dir)
+
+	report, err := DryRunMigration(StorageSQLite, path)
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if report.Migrated() {
+		t.Errorf("got %+v, want nothing to migrate", report)
+	}
+	if after := listDir(t, dir); len(after) != len(before) {
+		t.Errorf("dry run changed the files from %v to %v", before, after)
+	}
+}
+
+func TestPatientsWithoutServerGetDefault(t *testing.T) {
+	t.Cleanup(func() { SetDefaultGuild("") })
+	schedule := &MedicationSchedule{Version: 3, Patients: []Patient{{ID: "a", Name: "A"}, {ID: "b", Name: "B", GuildID: "other"}}}
+
+	// Without a default, patients stay unassigned and no server manages them
+	SetDefaultGuild("")
+	if _, err := MigrateSchedule(schedule); err != nil {
+		t.Fatal(err)
+	}
+	if schedule.GuildPatient("", "a") != nil || len(schedule.GuildPatients("home")) != 0 {
+		t.Errorf("a patient without a server is managed from one")
+	}
+
+	// Configuring one later assigns them when the state is next loaded
+	SetDefaultGuild("home")
+	if migrated, err := migrateLoaded(schedule); err != nil || !migrated {
+		t.Fatalf("got migrated %v (%v), want the patients assigned", migrated, err)
+	}
+	if a, b := schedule.Patient("a"), schedule.Patient("b"); a.GuildID != "home" || b.GuildID != "other" {
+		t.Errorf("got servers %q and %q, want home and other", a.GuildID, b.GuildID)
+	}
+	if migrated, err := migrateLoaded(schedule); err != nil || migrated {
+		t.Errorf("got migrated %v (%v) with every patient assigned", migrated, err)
+	}
+}
@@ -0,0 +1,304 @@
+package common
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Patient is a person or pet whose medications are tracked, and who gets reminded
+type Patient struct {
+	ID          string       `json:"id"`   // short unique key used in commands, e.g. "diluc"
+	Name        string       `json:"name"` // display name used in messages
+	DiscordIDs  []string     `json:"discord_ids"`
+	Emails      []string     `json:"emails,omitempty"`
+	Timezone    string       `json:"timezone,omitempty"` // IANA name, e.g. "Asia/Manila"; DefaultLocation when empty
+	Medications []Medication `json:"medications"`
+	// GuildID is the Discord server the patient was set up in, see InGuild
+	GuildID string `json:"guild_id,omitempty"`
+	// MessageTemplate is the greeting at the top of every reminder; {name} is replaced by Name
+	MessageTemplate string `json:"message_template,omitempty"`
+	// SimpleReminderTimes are "15:04" times the greeting alone is sent, without a medication list
+	SimpleReminderTimes []string `json:"simple_reminder_times,omitempty"`
+	// LastFired maps a slot key (see SlotKey) to the RFC3339 due time last sent
+	LastFired map[string]string `json:"last_fired,omitempty"`
+	// Travel gradually moves the schedule to another timezone, see TravelPlan
+	Travel *TravelPlan `json:"travel,omitempty"`
+	// SkipAcknowledgement sends reminders without Taken/Skipped buttons, counting every sent dose as given
+	SkipAcknowledgement bool `json:"skip_acknowledgement,omitempty"`
+	// Weights is the weighing history, oldest first, for doses prescribed in mg/kg
+	Weights []WeightEntry `json:"weights,omitempty"`
+}
+
+// defaultMessageTemplate is used when a patient has no greeting of their own
+const defaultMessageTemplate = "It's time for {name}'s meds! 💊✨"
+
+// Location returns the timezone the patient's medication times are expressed in today
+func (p *Patient) Location() *time.Location {
+	return p.LocationAt(time.Now())
+}
+
+// LocationAt returns the timezone the patient's medication times are expressed in at t,
+// following that day's step of a travel plan
+func (p *Patient) LocationAt(t time.Time) *time.Location {
+	if p.Travel != nil {
+		loc, err := p.Travel.Location(t)
+		if err == nil {
+			return loc
+		}
+		fmt.Printf("Invalid travel plan for %s, ignoring it: %v\n", p.Name, err)
+	}
+	if p.Timezone == "" {
+		return DefaultLocation
+	}
+	loc, err := LoadTimezone(p.Timezone)
+	if err != nil {
+		fmt.Printf("Invalid timezone %q for %s, using %s: %v\n", p.Timezone, p.Name, DefaultLocation, err)
+		return DefaultLocation
+	}
+	return loc
+}
+
+// Greeting renders the patient's message template
+func (p *Patient) Greeting() string {
+	template := p.MessageTemplate
+	if template == "" {
+		template = defaultMessageTemplate
+	}
+	return strings.ReplaceAll(template, "{name}", p.Name)
+}
+
+// Medication returns a pointer to the patient's medication with the given name, ignoring case
+func (p *Patient) Medication(name string) *Medication {
+	name = strings.TrimSpace(name)
+	for i := range p.Medications {
+		if strings.EqualFold(p.Medications[i].Name, name) {
+			return &p.Medications[i]
+		}
+	}
+	return nil
+}
+
+// HasActiveMedications reports whether any of the patient's medications is active
+func (p *Patient) HasActiveMedications() bool {
+	for _, med := range p.Medications {
+		if med.Active {
+			return true
+		}
+	}
+	return false
+}
+
+// InGuild reports whether the patient is managed from the given Discord server. Patients
+// without one aren't managed from any, see assignDefaultGuild, and direct messages
+// manage none.
+func (p *Patient) InGuild(guildID string) bool {
+	return guildID != "" && p.GuildID == guildID
+}
+
+// defaultGuildID is the Discord server patients without one are assigned to
+var defaultGuildID string
+
+// SetDefaultGuild changes the Discord server that patients set up before servers were
+// recorded, seeded or configured from the environment are assigned to
+func SetDefaultGuild(guildID string) {
+	defaultGuildID = strings.TrimSpace(guildID)
+}
+
+// assignDefaultGuild assigns the patients without a Discord server to the default one.
+// Without a default they are left for when one is configured.
+func assignDefaultGuild(schedule *MedicationSchedule) []string {
+	var changes, unassigned []string
+	for p := range schedule.Patients {
+		patient := &schedule.Patients[p]
+		switch {
+		case patient.GuildID != "":
+		case defaultGuildID == "":
+			unassigned = append(unassigned, patient.Name)
+		default:
+			patient.GuildID = defaultGuildID
+			changes = append(changes, fmt.Sprintf("assigned %s to server %s", patient.Name, defaultGuildID))
+		}
+	}
+	if len(unassigned) > 0 {
+		changes = append(changes, fmt.Sprintf("%s can't be managed from any server until DEFAULT_GUILD_ID is set", strings.Join(unassigned, ", ")))
+	}
+	return changes
+}
+
+// GuildPatients returns pointers to the patients managed from the given Discord server
+func (s *MedicationSchedule) GuildPatients(guildID string) []*Patient {
+	var patients []*Patient
+	for i := range s.Patients {
+		if s.Patients[i].InGuild(guildID) {
+			patients = append(patients, &s.Patients[i])
+		}
+	}
+	return patients
+}
+
+// GuildPatient is Patient limited to the patients managed from the given Discord server
+func (s *MedicationSchedule) GuildPatient(guildID, key string) *Patient {
+	if patient := s.Patient(key); patient != nil && patient.InGuild(guildID) {
+		return patient
+	}
+	// Another server may have a patient whose ID is this one's name
+	key = strings.TrimSpace(key)
+	for _, patient := range s.GuildPatients(guildID) {
+		if strings.EqualFold(patient.Name, key) {
+			return patient
+		}
+	}
+	return nil
+}
+
+// Patient returns a pointer to the patient matching the given ID or name, ignoring case
+func (s *MedicationSchedule) Patient(key string) *Patient {
+	key = strings.TrimSpace(key)
+	for i := range s.Patients {
+		if strings.EqualFold(s.Patients[i].ID, key) {
+			return &s.Patients[i]
+		}
+	}
+	for i := range s.Patients {
+		if strings.EqualFold(s.Patients[i].Name, key) {
+			return &s.Patients[i]
+		}
+	}
+	return nil
+}
+
+// findMedication returns the named medication of the given patient. Dose log entries
+// written before patient profiles have no patient ID, so those match any patient.
+func findMedication(schedule *MedicationSchedule, patientID, name string) (*Patient, Medication, bool) {
+	if patientID == "" {
+		for i := range schedule.Patients {
+			if med := schedule.Patients[i].Medication(name); med != nil {
+				return &schedule.Patients[i], *med, true
+			}
+		}
+		return nil, Medication{}, false
+	}
+
+	patient := schedule.Patient(patientID)
+	if patient == nil {
+		return nil, Medication{}, false
+	}
+	med := patient.Medication(name)
+	if med == nil {
+		return patient, Medication{}, false
+	}
+	return patient, *med, true
+}
+
+// upgradeLegacySchedule moves a single-patient state file into the patient list. The
+// old top-level medications go to the patient named by LEGACY_PATIENT_NAME, reminding
+// LEGACY_DISCORD_IDS and emailing LEGACY_EMAILS, and the simple reminder comes from the
+// user/reminder_msg/EMAIL_TO environment variables.
+func upgradeLegacySchedule(schedule *MedicationSchedule) []string {
+	if len(schedule.Patients) > 0 || (len(schedule.Medications) == 0 && len(schedule.LastFired) == 0) {
+		return nil
+	}
+
+	patient := Patient{
+		Name:        os.Getenv("LEGACY_PATIENT_NAME"),
+		DiscordIDs:  envList("LEGACY_DISCORD_IDS"),
+		Emails:      splitEmails(os.Getenv("LEGACY_EMAILS")),
+		Medications: schedule.Medications,
+		LastFired:   schedule.LastFired,
+	}
+	if patient.Name == "" {
+		patient.Name = "Patient"
+	}
+	patient.ID = legacyPatientID(patient.Name)
+
+	changes := []string{fmt.Sprintf("moved %d top-level medication(s) and their sent reminders into %s's patient profile", len(schedule.Medications), patient.Name)}
+	if len(patient.DiscordIDs) == 0 {
+		changes = append(changes, fmt.Sprintf("%s reminds nobody, since LEGACY_DISCORD_IDS is not set", patient.Name))
+	}
+	schedule.Patients = append(schedule.Patients, patient)
+	schedule.Medications = nil
+	schedule.LastFired = nil
+
+	if simple := legacySimplePatient(); simple != nil {
+		schedule.Patients = append(schedule.Patients, *simple)
+		changes = append(changes, fmt.Sprintf("added %s's simple reminder profile from the environment", simple.Name))
+	}
+	return changes
+}
+
+// legacyPrednisoneName is the medication the removed hardcoded taper applied to
+const legacyPrednisoneName = "Prednisone 20mg tab"
+
+// upgradePrednisoneSwitch turns the hardcoded Prednisone taper (twice a day for the
+// first 7 days, then 9pm only) into phases on the medication itself
+func upgradePrednisoneSwitch(schedule *MedicationSchedule) []string {
+	var changes []string
+	for p := range schedule.Patients {
+		med := schedule.Patients[p].Medication(legacyPrednisoneName)
+		if med == nil || len(med.Phases) > 0 {
+			continue
+		}
+
+		med.Phases = []Phase{
+			{FromDay: 1, ToDay: 7, Times: []string{"09:00", "21:00"}},
+			{FromDay: 8, Times: []string{"21:00"}},
+		}
+		if med.Notes == "After 7 days, switch to 9pm only" {
+			med.Notes = ""
+		}
+		changes = append(changes, fmt.Sprintf("gave %s's %s its taper as phases: 09:00 and 21:00 on days 1-7, then 21:00 only", schedule.Patients[p].Name, med.Name))
+	}
+
+	if schedule.PrednisoneSwitch {
+		schedule.PrednisoneSwitch = false
+		changes = append(changes, "dropped the prednisone_switch flag")
+	}
+	return changes
+}
+
+// legacySimplePatient builds the simple reminder profile configured by the user,
+// reminder_msg, EMAIL_TO, SIMPLE_REMINDER_TIME and SIMPLE_REMINDER_NAME environment
+// variables in the default server, or nil when no users are
+func legacySimplePatient() *Patient {
+	ids := envList("user")
+	if len(ids) == 0 {
+		return nil
+	}
+
+	name := os.Getenv("SIMPLE_REMINDER_NAME")
+	if name == "" {
+		name = "Reminder"
+	}
+	at := os.Getenv("SIMPLE_REMINDER_TIME")
+	if at == "" {
+		at = "10:00"
+	}
+
+	return &Patient{
+		ID:                  legacyPatientID(name),
+		Name:                name,
+		GuildID:             defaultGuildID,
+		DiscordIDs:          ids,
+		Emails:              splitEmails(os.Getenv("EMAIL_TO")),
+		MessageTemplate:     os.Getenv("reminder_msg"),
+		SimpleReminderTimes: []string{at},
+	}
+}
+
+// legacyPatientID makes the ID of a patient configured from the environment, e.g. "mr-whiskers"
+func legacyPatientID(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), "-"))
+}
+
+// envList reads a comma separated environment variable, leaving out empty items
+func envList(name string) []string {
+	var items []string
+	for _, item := range strings.Split(os.Getenv(name), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,228 @@
+package common
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxDoseLookahead bounds how far ahead the next dose of a medication is searched for
+const maxDoseLookahead = 366
+
+// Phase is one stage of a tapering or phased regimen, e.g. days 1-7 twice a day at
+// 1/2 tab, then days 8-14 once a day. Days count from the start date as day 1.
+type Phase struct {
+	FromDay int      `json:"from_day"`
+	ToDay   int      `json:"to_day,omitempty"` // last day of the phase, 0 runs until the course ends
+	Times   []string `json:"times"`
+	Dose    *Dose    `json:"dose,omitempty"`  // nil keeps the medication's dose
+	Notes   string   `json:"notes,omitempty"` // empty keeps the medication's notes
+}
+
+// Covers reports whether the phase applies on the given course day
+func (p Phase) Covers(day int) bool {
+	return day >= p.FromDay && (p.ToDay == 0 || day <= p.ToDay)
+}
+
+// Days describes the day range of the phase, e.g. "days 1–7" or "day 15 onwards"
+func (p Phase) Days() string {
+	switch {
+	case p.ToDay == 0:
+		return fmt.Sprintf("day %d onwards", p.FromDay)
+	case p.ToDay == p.FromDay:
+		return fmt.Sprintf("day %d", p.FromDay)
+	default:
+		return fmt.Sprintf("days %d–%d", p.FromDay, p.ToDay)
+	}
+}
+
+// ValidatePhases checks that phases are ordered, don't overlap and only the last is open ended
+func ValidatePhases(phases []Phase) error {
+	for i, p := range phases {
+		if p.FromDay < 1 {
+			return fmt.Errorf("phase %d must start on day 1 or later", i+1)
+		}
+		if p.ToDay != 0 && p.ToDay < p.FromDay {
+			return fmt.Errorf("phase %d ends before it starts", i+1)
+		}
+		if len(p.Times) == 0 {
+			return fmt.Errorf("phase %d needs at least one time", i+1)
+		}
+		for _, t := range p.Times {
+			if _, _, err := ParseTimeOfDay(t); err != nil {
+				return fmt.Errorf("phase %d: %v", i+1, err)
+			}
+		}
+		if i == 0 {
+			continue
+		}
+
+		prev := phases[i-1]
+		if prev.ToDay == 0 {
+			return fmt.Errorf("phase %d runs until the course ends, so no phase can follow it", i)
+		}
+		if p.FromDay <= prev.ToDay {
+			return fmt.Errorf("phase %d overlaps phase %d", i+1, i)
+		}
+	}
+	return nil
+}
+
+// SortPhases orders phases by their first day
+func SortPhases(phases []Phase) {
+	sort.SliceStable(phases, func(i, j int) bool { return phases[i].FromDay < phases[j].FromDay })
+}
+
+// CourseDay returns which local day of the course t falls on, the day it started being day 1
+func (m Medication) CourseDay(t time.Time, zone Locator) (int, error) {
+	if m.Start.IsZero() {
+		return 0, fmt.Errorf("%s has no start", m.Name)
+	}
+	return daysBetween(m.Start, t, zone) + 1, nil
+}
+
+// Phase returns the phase in effect on the given course day, or nil when none is
+func (m Medication) Phase(day int) *Phase {
+	for i := range m.Phases {
+		if m.Phases[i].Covers(day) {
+			return &m.Phases[i]
+		}
+	}
+	return nil
+}
+
+// OnDay returns the medication as it is taken on the local day containing t: it has no
+// times on days its recurrence skips, and a phased medication takes its times, dose and
+// notes from the current phase and has no times on days no phase covers.
+func (m Medication) OnDay(t time.Time, zone Locator) Medication {
+	if len(m.Phases) == 0 && m.Recurrence == nil {
+		return m
+	}
+
+	day, err := m.CourseDay(t, zone)
+	if err != nil {
+		fmt.Printf("Error finding the course day of %s: %v\n", m.Name, err)
+		m.Times = nil
+		return m
+	}
+
+	if m.Recurrence != nil && !m.Recurrence.Due(day, t.In(zone(t))) {
+		m.Times = nil
+		return m
+	}
+	if len(m.Phases) == 0 {
+		return m
+	}
+
+	phase := m.Phase(day)
+	if phase == nil {
+		m.Times = nil
+		return m
+	}
+
+	m.Times = phase.Times
+	if phase.Dose != nil {
+		m.Dose = *phase.Dose
+	}
+	if phase.Notes != "" {
+		m.Notes = phase.Notes
+	}
+	return m
+}
+
+// dosesOn returns the instants the medication is due on the local day containing t,
+// leaving out those before the course starts or after it ends
+func (m Medication) dosesOn(t time.Time, zone Locator) []time.Time {
+	loc := zone(t)
+	local := t.In(loc)
+
+	var doses []time.Time
+	for _, value := range m.OnDay(local, zone).Times {
+		hour, minute, err := ParseTimeOfDay(value)
+		if err != nil {
+			fmt.Printf("Skipping %s: %v\n", m.Name, err)
+			continue
+		}
+		at := LocalTime(local.Year(), local.Month(), local.Day(), hour, minute, loc)
+		if m.InCourse(at, zone) {
+			doses = append(doses, at)
+		}
+	}
+	sort.Slice(doses, func(i, j int) bool { return doses[i].Before(doses[j]) })
+	return doses
+}
+
+// NextDoseTime returns the first instant strictly after now the medication is due
+func (m Medication) NextDoseTime(now time.Time, zone Locator) (time.Time, bool) {
+	loc := zone(now)
+	local := now.In(loc)
+	for d := 0; d <= maxDoseLookahead; d++ {
+		// Each day's doses are in the timezone of that day, found from its noon
+		day := time.Date(local.Year(), local.Month(), local.Day()+d, 12, 0, 0, 0, loc)
+		for _, at := range m.dosesOn(day, zone) {
+			if at.After(now) {
+				return at, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// DoseTimesBetween returns every instant after from and at or before to the medication is due
+func (m Medication) DoseTimesBetween(from, to time.Time, zone Locator) []time.Time {
+	loc := zone(from)
+	start := from.In(loc)
+	end := to.In(loc)
+
+	last := time.Date(end.Year(), end.Month(), end.Day(), 12, 0, 0, 0, loc)
+
+	var doses []time.Time
+	for day := time.Date(start.Year(), start.Month(), start.Day(), 12, 0, 0, 0, loc); !day.After(last); day = day.AddDate(0, 0, 1) {
+		for _, at := range m.dosesOn(day, zone) {
+			if at.After(from) && !at.After(to) {
+				doses = append(doses, at)
+			}
+		}
+	}
+	return doses
+}
+
+// FormatPhases lists a medication's phases, marking the one in effect on the given day
+// and how much each phase changes the daily amount from the one before
+func FormatPhases(med Medication, day int) string {
+	var lines []string
+	var previous Dose
+	for i, p := range med.Phases {
+		dose := med.Dose
+		if p.Dose != nil {
+			dose = *p.Dose
+		}
+
+		marker := "▫️"
+		if p.Covers(day) {
+			marker = "▶️"
+		}
+		line := fmt.Sprintf("%s Phase %d, %s: %s at %s", marker, i+1, p.Days(), dose, strings.Join(p.Times, ", "))
+
+		daily, err := dose.Times(len(p.Times))
+		if err != nil {
+			daily = Dose{}
+		}
+		if change, err := daily.Sub(previous); err == nil && !change.Amount.IsZero() {
+			if change.Amount.Cmp(Rational{0, 1}) < 0 {
+				change.Amount = change.Amount.Neg()
+				line += fmt.Sprintf(" ↓ %s a day", change)
+			} else {
+				line += fmt.Sprintf(" ↑ %s a day", change)
+			}
+		}
+		previous = daily
+
+		if p.Notes != "" {
+			line += " (" + p.Notes + ")"
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
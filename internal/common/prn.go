@@ -0,0 +1,163 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PRNRule limits an as-needed (PRN) medication, which is never reminded on a schedule
+type PRNRule struct {
+	MinHoursApart int `json:"min_hours_apart,omitempty"` // 0 allows doses back to back
+	MaxPer24h     int `json:"max_per_24h,omitempty"`     // 0 means no daily cap
+}
+
+// MinSpacing returns the least time allowed between two doses
+func (r PRNRule) MinSpacing() time.Duration {
+	return time.Duration(r.MinHoursApart) * time.Hour
+}
+
+// String describes the rule, e.g. "as needed, at least 6h apart, max 4 per 24h"
+func (r PRNRule) String() string {
+	text := "as needed"
+	if r.MinHoursApart > 0 {
+		text += fmt.Sprintf(", at least %dh apart", r.MinHoursApart)
+	}
+	if r.MaxPer24h > 0 {
+		text += fmt.Sprintf(", max %d per 24h", r.MaxPer24h)
+	}
+	return text
+}
+
+// IsPRNSpec reports whether a times value marks a medication as taken only when needed
+func IsPRNSpec(value string) bool {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "prn", "as needed", "as-needed", "when needed":
+		return true
+	}
+	return false
+}
+
+// PRNCheck is the verdict on taking an as-needed dose at a given time
+type PRNCheck struct {
+	LastTaken   time.Time // latest earlier dose, zero when there is none
+	TakenIn24h  int       // doses taken in the 24 hours before
+	TooSoon     bool      // the minimum spacing since LastTaken isn't over
+	OverCap     bool      // the daily cap is already reached
+	AllowedFrom time.Time // earliest time a dose is allowed
+}
+
+// Allowed reports whether the dose keeps to the rule
+func (c PRNCheck) Allowed() bool {
+	return !c.TooSoon && !c.OverCap
+}
+
+// CheckPRN checks a dose at the given time against the rule and the earlier doses taken
+func CheckPRN(rule PRNRule, taken []time.Time, at time.Time) PRNCheck {
+	var window []time.Time
+	check := PRNCheck{AllowedFrom: at}
+	for _, t := range taken {
+		if t.After(at) {
+			continue
+		}
+		if t.After(check.LastTaken) {
+			check.LastTaken = t
+		}
+		if at.Sub(t) < 24*time.Hour {
+			window = append(window, t)
+		}
+	}
+	sort.Slice(window, func(i, j int) bool { return window[i].Before(window[j]) })
+	check.TakenIn24h = len(window)
+
+	if rule.MinHoursApart > 0 && !check.LastTaken.IsZero() {
+		if next := check.LastTaken.Add(rule.MinSpacing()); next.After(at) {
+			check.TooSoon = true
+			check.AllowedFrom = next
+		}
+	}
+
+	// The oldest dose that keeps the count at the cap has to leave the 24 hour window
+	if rule.MaxPer24h > 0 && len(window) >= rule.MaxPer24h {
+		check.OverCap = true
+		if next := window[len(window)-rule.MaxPer24h].Add(24 * time.Hour); next.After(check.AllowedFrom) {
+			check.AllowedFrom = next
+		}
+	}
+	return check
+}
+
+// takenTimes returns when a patient's medication was confirmed taken
+func (l *DoseLog) takenTimes(patientID, medName string) []time.Time {
+	var taken []time.Time
+	for _, entry := range l.Entries {
+		if entry.Status != DoseTaken || !entryMatches(entry, patientID, medName) {
+			continue
+		}
+		taken = append(taken, entry.ActedAt)
+	}
+	return taken
+}
+
+// ErrNoOpenDose is returned by TakeDose for a medication taken at fixed times that has no
+// reminded dose left to confirm
+var ErrNoOpenDose = errors.New("no reminded dose is waiting to be confirmed")
+
+// TakeDose records that a dose was taken outside of a reminder's buttons. A scheduled
+// medication's latest open dose is marked taken when there is one; without one only
+// interval doses are recorded, as they restart the interval, while an extra dose at
+// fixed times would count against the course. An as-needed dose is checked against the
+// medication's rule first and, unless forced, only recorded when allowed. The check returned is for the dose being taken, and the time the
+// following dose is allowed is returned alongside.
+func TakeDose(patientID string, med Medication, userID string, at time.Time, force bool) (recorded bool, check PRNCheck, nextAllowed time.Time, err error) {
+	err = UpdateDoseLog(func(log *DoseLog) error {
+		if med.PRN != nil {
+			taken := log.takenTimes(patientID, med.Name)
+			check = CheckPRN(*med.PRN, taken, at)
+			if !check.Allowed() && !force {
+				return nil
+			}
+			nextAllowed = CheckPRN(*med.PRN, append(taken, at), at).AllowedFrom
+		}
+
+		// Close the latest open dose of a scheduled medication
+		var open *DoseEntry
+		for i := range log.Entries {
+			entry := &log.Entries[i]
+			if !entry.isOpen() || !entryMatches(*entry, patientID, med.Name) {
+				continue
+			}
+			if open == nil || entry.DueAt.After(open.DueAt) {
+				open = entry
+			}
+		}
+		if open != nil {
+			open.Status = DoseTaken
+			open.ActedBy = userID
+			open.ActedAt = at
+			open.SnoozedUntil = time.Time{}
+			recorded = true
+			return nil
+		}
+		if med.PRN == nil && med.Interval == nil {
+			return ErrNoOpenDose
+		}
+
+		log.Entries = append(log.Entries, DoseEntry{
+			ReminderID: NewReminderID(),
+			Patient:    patientID,
+			Medication: med.Name,
+			Dose:       med.Dose.String(),
+			DueAt:      at,
+			SentAt:     at,
+			Status:     DoseTaken,
+			ActedBy:    userID,
+			ActedAt:    at,
+		})
+		recorded = true
+		return nil
+	})
+	return recorded, check, nextAllowed, err
+}
@@ -0,0 +1,98 @@
+package common
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCheckPRN(t *testing.T) {
+	at := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	hoursAgo := func(hours ...float64) []time.Time {
+		taken := make([]time.Time, 0, len(hours))
+		for _, h := range hours {
+			taken = append(taken, at.Add(-time.Duration(h*float64(time.Hour))))
+		}
+		return taken
+	}
+	rule := PRNRule{MinHoursApart: 6, MaxPer24h: 3}
+
+	tests := []struct {
+		name        string
+		taken       []time.Time
+		wantTooSoon bool
+		wantOverCap bool
+		wantFrom    time.Time
+	}{
+		{"first dose", nil, false, false, at},
+		{"spaced out", hoursAgo(6, 12), false, false, at},
+		{"too soon", hoursAgo(4), true, false, at.Add(2 * time.Hour)},
+		{"at the cap", hoursAgo(7, 14, 21), false, true, at.Add(3 * time.Hour)},
+		{"cap counts 24 hours only", hoursAgo(7, 14, 24), false, false, at},
+		{"too soon and at the cap", hoursAgo(1, 8, 16), true, true, at.Add(8 * time.Hour)},
+		{"later doses ignored", []time.Time{at.Add(time.Hour)}, false, false, at},
+	}
+	for _, tt := range tests {
+		check := CheckPRN(rule, tt.taken, at)
+		if check.TooSoon != tt.wantTooSoon || check.OverCap != tt.wantOverCap || !check.AllowedFrom.Equal(tt.wantFrom) {
+			t.Errorf("%s: got too soon %v, over cap %v, allowed from %v, want %v, %v, %v",
+				tt.name, check.TooSoon, check.OverCap, check.AllowedFrom, tt.wantTooSoon, tt.wantOverCap, tt.wantFrom)
+		}
+	}
+}
+
+func TestTakeDose(t *testing.T) {
+	SetStore(newTestStore(t))
+	t.Cleanup(func() { SetStore(NewJSONStore(stateFile, doseLogFile, settingsFile, defaultStateBackups)) })
+
+	at := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	fixed := Medication{Name: "A1", Times: []string{"08:00"}, Active: true}
+	prn := Medication{Name: "B1", Active: true, PRN: &PRNRule{MinHoursApart: 6}}
+	interval := Medication{Name: "C1", Active: true, Interval: &IntervalSchedule{EveryHours: 8, Start: at}}
+
+	// A dose at fixed times is only confirmed from its reminder
+	if recorded, _, _, err := TakeDose("a", fixed, "1", at, false); recorded || !errors.Is(err, ErrNoOpenDose) {
+		t.Errorf("fixed dose without a reminder: recorded %v (%v), want ErrNoOpenDose", recorded, err)
+	}
+	due := time.Date(2026, 3, 10, 8, 0, 0, 0, time.UTC)
+	err := UpdateDoseLog(func(log *DoseLog) error {
+		log.Entries = append(log.Entries, DoseEntry{ReminderID: "r1", Patient: "a", Medication: "A1", DueAt: due, SentAt: due, Status: DosePending})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("logging reminder: %v", err)
+	}
+	if recorded, _, _, err := TakeDose("a", fixed, "1", at, false); !recorded || err != nil {
+		t.Errorf("fixed dose with a reminder: recorded %v (%v), want it recorded", recorded, err)
+	}
+
+	// An interval dose given early restarts the interval
+	if recorded, _, _, err := TakeDose("a", interval, "1", at, false); !recorded || err != nil {
+		t.Errorf("interval dose without a reminder: recorded %v (%v), want it recorded", recorded, err)
+	}
+
+	// As-needed doses are refused too soon after the last one, unless forced
+	if recorded, _, next, err := TakeDose("a", prn, "1", at, false); !recorded || err != nil || !next.Equal(at.Add(6*time.Hour)) {
+		t.Errorf("first as-needed dose: recorded %v (%v), next at %v", recorded, err, next)
+	}
+	if recorded, check, _, err := TakeDose("a", prn, "1", at.Add(time.Hour), false); recorded || err != nil || !check.TooSoon {
+		t.Errorf("as-needed dose too soon: recorded %v (%v), too soon %v, want it refused", recorded, err, check.TooSoon)
+	}
+	if recorded, _, _, err := TakeDose("a", prn, "1", at.Add(time.Hour), true); !recorded || err != nil {
+		t.Errorf("forced as-needed dose: recorded %v (%v), want it recorded", recorded, err)
+	}
+
+	log, err := LoadDoseLog()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	var taken int
+	for _, e := range log.Entries {
+		if e.Status == DoseTaken {
+			taken++
+		}
+	}
+	if len(log.Entries) != 4 || taken != 4 {
+		t.Errorf("got %d entries, %d taken, want the reminder, the interval dose and two as-needed doses taken", len(log.Entries), taken)
+	}
+}
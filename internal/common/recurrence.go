@@ -0,0 +1,194 @@
+package common
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Recurrence limits the days a medication is taken on. Every rule that is set has to
+// match; specific dates replace the other rules.
+type Recurrence struct {
+	Weekdays  []string `json:"weekdays,omitempty"`   // "mon" to "sun"
+	EveryDays int      `json:"every_days,omitempty"` // 2 is every other day, counted from the start date
+	// CycleDays repeats a cycle of that many days, taken only on its first CycleOnDays days
+	CycleDays   int      `json:"cycle_days,omitempty"`
+	CycleOnDays int      `json:"cycle_on_days,omitempty"`
+	Dates       []string `json:"dates,omitempty"` // YYYY-MM-DD
+}
+
+// weekdayNames are the short weekday names used by recurrence rules, indexed by time.Weekday
+var weekdayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// Due reports whether the medication is taken on the given course day and local date
+func (r Recurrence) Due(day int, date time.Time) bool {
+	if len(r.Dates) > 0 {
+		today := date.Format("2006-01-02")
+		for _, d := range r.Dates {
+			if d == today {
+				return true
+			}
+		}
+		return false
+	}
+
+	if day < 1 {
+		return false
+	}
+	if len(r.Weekdays) > 0 {
+		name := weekdayNames[date.Weekday()]
+		found := false
+		for _, w := range r.Weekdays {
+			if w == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if r.EveryDays > 1 && (day-1)%r.EveryDays != 0 {
+		return false
+	}
+	if r.CycleDays > 0 && (day-1)%r.CycleDays >= r.CycleOnDays {
+		return false
+	}
+	return true
+}
+
+// String describes the rule, e.g. "Mon, Thu" or "days 1–21 of every 28-day cycle"
+func (r Recurrence) String() string {
+	if len(r.Dates) > 0 {
+		dates := make([]string, 0, len(r.Dates))
+		for _, d := range r.Dates {
+			if t, err := time.Parse("2006-01-02", d); err == nil {
+				d = t.Format("Jan 2, 2006")
+			}
+			dates = append(dates, d)
+		}
+		return "on " + strings.Join(dates, "; ")
+	}
+
+	var parts []string
+	if len(r.Weekdays) > 0 {
+		days := make([]string, 0, len(r.Weekdays))
+		for _, w := range r.Weekdays {
+			days = append(days, strings.ToUpper(w[:1])+w[1:])
+		}
+		parts = append(parts, strings.Join(days, ", "))
+	}
+	switch {
+	case r.EveryDays == 2:
+		parts = append(parts, "every other day")
+	case r.EveryDays > 2:
+		parts = append(parts, fmt.Sprintf("every %d days", r.EveryDays))
+	}
+	if r.CycleDays > 0 {
+		parts = append(parts, fmt.Sprintf("days 1–%d of every %d-day cycle", r.CycleOnDays, r.CycleDays))
+	}
+	if len(parts) == 0 {
+		return "daily"
+	}
+	return strings.Join(parts, ", ")
+}
+
+var (
+	everyDaysPattern = regexp.MustCompile(`(?i)^every\s+(\d+)\s+days?$`)
+	cyclePattern     = regexp.MustCompile(`(?i)^(\d+)\s*(?:/|of)\s*(\d+)$`)
+	datePattern      = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+)
+
+// ParseRecurrence reads a recurrence rule: "daily", weekdays like "mon, thu", "weekdays",
+// "weekends", "every other day", "every 3 days", a cycle like "21/28" or "21 of 28", or
+// dates like "2026-01-05, 2026-02-05". Daily returns nil, as that needs no rule.
+func ParseRecurrence(value string) (*Recurrence, error) {
+	value = strings.TrimSpace(value)
+	lower := strings.ToLower(value)
+
+	switch {
+	case lower == "" || lower == "daily" || lower == "every day":
+		return nil, nil
+	case lower == "every other day":
+		return &Recurrence{EveryDays: 2}, nil
+	case lower == "weekdays":
+		return &Recurrence{Weekdays: []string{"mon", "tue", "wed", "thu", "fri"}}, nil
+	case lower == "weekends":
+		return &Recurrence{Weekdays: []string{"sat", "sun"}}, nil
+	}
+
+	if match := everyDaysPattern.FindStringSubmatch(lower); match != nil {
+		n, _ := strconv.Atoi(match[1])
+		if n == 1 {
+			return nil, fmt.Errorf("every 1 day is every day, use daily")
+		}
+		if n < 2 || n > 366 {
+			return nil, fmt.Errorf("every N days must be between 2 and 366")
+		}
+		return &Recurrence{EveryDays: n}, nil
+	}
+
+	if match := cyclePattern.FindStringSubmatch(lower); match != nil {
+		on, _ := strconv.Atoi(match[1])
+		length, _ := strconv.Atoi(match[2])
+		if on < 1 || length < 2 || on >= length || length > 366 {
+			return nil, fmt.Errorf("a cycle needs fewer days on than its length, e.g. 21/28")
+		}
+		return &Recurrence{CycleDays: length, CycleOnDays: on}, nil
+	}
+
+	parts := strings.FieldsFunc(lower, func(r rune) bool { return r == ',' || r == ' ' })
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("invalid recurrence %q", value)
+	}
+
+	if datePattern.MatchString(parts[0]) {
+		seen := make(map[string]bool)
+		var dates []string
+		for _, p := range parts {
+			if _, err := time.Parse("2006-01-02", p); err != nil {
+				return nil, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", p)
+			}
+			if !seen[p] {
+				seen[p] = true
+				dates = append(dates, p)
+			}
+		}
+		sort.Strings(dates)
+		return &Recurrence{Dates: dates}, nil
+	}
+
+	found := make(map[int]bool)
+	for _, p := range parts {
+		idx := weekdayIndex(p)
+		if idx < 0 {
+			return nil, fmt.Errorf("invalid recurrence %q, expected e.g. daily, mon, thu, weekdays, every other day, 21/28 or 2026-01-05", value)
+		}
+		found[idx] = true
+	}
+	rule := &Recurrence{}
+	// Keep the week in order, starting on Monday
+	for _, idx := range []int{1, 2, 3, 4, 5, 6, 0} {
+		if found[idx] {
+			rule.Weekdays = append(rule.Weekdays, weekdayNames[idx])
+		}
+	}
+	return rule, nil
+}
+
+// weekdayIndex returns the time.Weekday of a weekday name like "mon" or "monday", or -1
+func weekdayIndex(name string) int {
+	if len(name) < 3 {
+		return -1
+	}
+	for i := range weekdayNames {
+		full := strings.ToLower(time.Weekday(i).String())
+		if strings.HasPrefix(full, name) {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,106 @@
+package common
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRecurrence(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    *Recurrence
+		wantErr bool
+	}{
+		{"daily", nil, false},
+		{"Every day", nil, false},
+		{"", nil, false},
+		{"every other day", &Recurrence{EveryDays: 2}, false},
+		{"every 3 days", &Recurrence{EveryDays: 3}, false},
+		{"every 1 day", nil, true},
+		{"every 0 days", nil, true},
+		{"every 400 days", nil, true},
+		{"thu, Mon", &Recurrence{Weekdays: []string{"mon", "thu"}}, false},
+		{"monday wednesday", &Recurrence{Weekdays: []string{"mon", "wed"}}, false},
+		{"weekdays", &Recurrence{Weekdays: []string{"mon", "tue", "wed", "thu", "fri"}}, false},
+		{"Weekends", &Recurrence{Weekdays: []string{"sat", "sun"}}, false},
+		{"21/28", &Recurrence{CycleDays: 28, CycleOnDays: 21}, false},
+		{"21 of 28", &Recurrence{CycleDays: 28, CycleOnDays: 21}, false},
+		{"28/28", nil, true},
+		{"2026-02-05, 2026-01-05, 2026-01-05", &Recurrence{Dates: []string{"2026-01-05", "2026-02-05"}}, false},
+		{"2026-02-30", nil, true},
+		{"mo", nil, true},
+		{"sometimes", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRecurrence(tt.value)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%q: got %+v, want an error", tt.value, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got %+v (%v), want %+v", tt.value, got, err, tt.want)
+		}
+	}
+}
+
+func TestRemindersFollowRecurrence(t *testing.T) {
+	start := time.Date(2026, 3, 2, 0, 0, 0, 0, DefaultLocation) // a Monday
+	patient := &Patient{
+		ID:   "a",
+		Name: "A",
+		Medications: []Medication{
+			{Name: "A1", Times: []string{"08:00"}, Active: true, Start: start, Recurrence: &Recurrence{Weekdays: []string{"mon", "thu"}}},
+			{Name: "B1", Times: []string{"08:00"}, Active: true, Start: start, Recurrence: &Recurrence{EveryDays: 2}},
+			{Name: "C1", Times: []string{"08:00"}, Active: true, Start: start, Recurrence: &Recurrence{CycleDays: 7, CycleOnDays: 2}},
+		},
+	}
+
+	tests := []struct {
+		day  int
+		want []string
+	}{
+		{2, []string{"A1", "B1", "C1"}}, // Monday, course day 1
+		{3, []string{"C1"}},
+		{4, []string{"B1"}},
+		{5, []string{"A1"}},
+		{6, []string{"B1"}},
+		{9, []string{"A1", "C1"}}, // day 8 starts the next cycle
+	}
+	for _, tt := range tests {
+		at := time.Date(2026, 3, tt.day, 8, 0, 0, 0, DefaultLocation)
+		var got []string
+		for _, med := range GetCurrentReminders(patient, nil, at) {
+			got = append(got, med.Name)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("March %d: reminded %v, want %v", tt.day, got, tt.want)
+		}
+	}
+}
+
+func TestScheduleShowsRecurrence(t *testing.T) {
+	patient := &Patient{
+		ID:   "a",
+		Name: "A",
+		Medications: []Medication{
+			{Name: "A1", Times: []string{"08:00"}, Active: true, Start: time.Now().AddDate(0, 0, -1), Recurrence: &Recurrence{Weekdays: []string{"mon", "thu"}}},
+			{Name: "B1", Times: []string{"08:00"}, Active: true, Start: time.Now().AddDate(0, 0, -30), Recurrence: &Recurrence{Dates: []string{"2020-01-01"}}},
+		},
+	}
+
+	msg := GetAllActiveMedications(patient)
+	a1, b1, _ := strings.Cut(msg, "B1")
+	if !strings.Contains(a1, "Repeats: Mon, Thu") {
+		t.Errorf("A1's rule is missing from:\n%s", msg)
+	}
+	if !strings.Contains(a1, "Next dose: Mon") && !strings.Contains(a1, "Next dose: Thu") {
+		t.Errorf("A1's next dose isn't on a Monday or Thursday:\n%s", msg)
+	}
+	if !strings.Contains(b1, "Repeats: on Jan 1, 2020") || strings.Contains(b1, "Next dose") {
+		t.Errorf("B1 should show its date and no next dose:\n%s", msg)
+	}
+}
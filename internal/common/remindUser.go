@@ -12,8 +12,8 @@ import (
 	"github.com/jordan-wright/email"
 )
 
-// RemindUserManual sends all active medications regardless of time (for manual testing)
-func RemindUserManual(sess *discordgo.Session) {
+// RemindUserManual sends all of a patient's active medications regardless of time (for manual testing)
+func RemindUserManual(sess *discordgo.Session, patientID string) {
 	fmt.Println("Manual reminder service started.")
 
 	// Nil check for session
@@ -22,6 +22,10 @@ func RemindUserManual(sess *discordgo.Session) {
 		return
 	}
 
+	// Update medication counts based on elapsed days
+	fmt.Println("Updating medication counts...")
+	RefreshMedicationCounts()
+
 	// Load medication schedule
 	fmt.Println("Loading medication schedule...")
 	schedule, err := LoadMedicationState()
@@ -31,19 +35,21 @@ func RemindUserManual(sess *discordgo.Session) {
 	}
 	fmt.Println("Medication schedule loaded successfully.")
 
-	// Update medication counts based on elapsed days
-	fmt.Println("Updating medication counts...")
-	UpdateMedicationCounts(schedule)
+	patient := schedule.Patient(patientID)
+	if patient == nil {
+		fmt.Printf("Error: patient %s not found\n", patientID)
+		return
+	}
 
 	// Get ALL active medications for manual testing
 	var reminders []Medication
-	for _, med := range schedule.Medications {
+	for _, med := range patient.Medications {
 		if med.Active {
 			reminders = append(reminders, med)
 		}
 	}
 
-	fmt.Printf("Found %d active medications.\n", len(reminders))
+	fmt.Printf("Found %d active medications for %s.\n", len(reminders), patient.Name)
 
 	if len(reminders) == 0 {
 		fmt.Println("No active medications found.")
@@ -51,132 +57,177 @@ func RemindUserManual(sess *discordgo.Session) {
 	}
 
 	// Format the reminder message
-	reminderMsg := FormatReminderMessage(reminders)
+	reminderMsg := FormatReminderMessage(patient, reminders)
 
-	// Send to JP (hardcoded user for medication tracking)
-	userID := JPDiscordID
-	if userID == "" {
-		fmt.Println("Error: User ID is empty")
+	deliverReminder(sess, patient, reminderMsg, "Medication Reminder (Manual Test)", "")
+}
+
+// RemindUser sends a patient's medications due at the given instant
+func RemindUser(sess *discordgo.Session, patientID string, dueAt time.Time) {
+	fmt.Println("Reminder service started.")
+
+	// Nil check for session
+	if sess == nil {
+		fmt.Println("Error: Discord session is nil")
 		return
 	}
 
-	// Send Discord DM asynchronously
-	go func() {
-		defer func() {
-			if r := recover(); r != nil {
-				fmt.Printf("Discord DM panic: %v\n", r)
-			}
-		}()
+	doseLog, err := LoadDoseLog()
+	if err != nil {
+		fmt.Printf("Error loading dose log: %v\n", err)
+	}
 
-		channel, err := sess.UserChannelCreate(userID)
-		if err != nil {
-			fmt.Printf("Error creating DM channel with user %s: %v\n", userID, err)
-			return
+	// Recount the courses, pick the doses due and remember their slots were sent as one
+	// change, so a restart doesn't resend them
+	var patient *Patient
+	var reminders []Medication
+	err = UpdateMedicationState(func(schedule *MedicationSchedule) error {
+		counted := UpdateMedicationCounts(schedule, doseLog)
+		patient = schedule.Patient(patientID)
+		if patient == nil {
+			return fmt.Errorf("patient %s not found", patientID)
 		}
 
-		_, err = sess.ChannelMessageSend(channel.ID, reminderMsg)
-		if err != nil {
-			fmt.Printf("Error sending message to user %s: %v\n", userID, err)
-		} else {
-			fmt.Printf("Sent manual reminder to user %s\n", userID)
-		}
-	}()
-
-	// Send emails asynchronously
-	go func() {
-		defer func() {
-			if r := recover(); r != nil {
-				fmt.Printf("Email sending panic: %v\n", r)
-			}
-		}()
-
-		// Parse and trim email addresses
-		emailList := strings.Split(JPEmails, ",")
-		var trimmedEmails []string
-		for _, email := range emailList {
-			if trimmed := strings.TrimSpace(email); trimmed != "" {
-				trimmedEmails = append(trimmedEmails, trimmed)
-			}
+		// Get reminders due at this time
+		reminders = GetCurrentReminders(patient, doseLog, dueAt)
+		if len(reminders) == 0 && !counted {
+			return ErrNoChanges
 		}
+		MarkReminded(patient, reminders, dueAt)
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("Error updating medication state: %v\n", err)
+		return
+	}
 
-		if len(trimmedEmails) == 0 {
-			fmt.Println("No valid email addresses")
-			return
-		}
+	if len(reminders) == 0 {
+		fmt.Printf("No medications due for %s at this time.\n", patient.Name)
+		return
+	}
 
-		subj := "Medication Reminder (Manual Test)"
-		plainText := strings.ReplaceAll(reminderMsg, "**", "")
+	reminderID := NewReminderID()
+	if err := RecordReminder(reminderID, patient, reminders, dueAt); err != nil {
+		fmt.Printf("Error recording doses: %v\n", err)
+	}
+	// Without acknowledgements the dose counts as given once sent
+	if patient.SkipAcknowledgement {
+		RefreshMedicationCounts()
+	}
 
-		if err := sendEmail(trimmedEmails, subj, plainText); err != nil {
-			fmt.Printf("Error sending email to %v: %v\n", trimmedEmails, err)
-		} else {
-			fmt.Printf("Sent manual email reminder to %v\n", trimmedEmails)
-		}
-	}()
+	deliverReminder(sess, patient, FormatReminderMessage(patient, reminders), "Medication Reminder", reminderID)
+	CheckStock(sess, patient.ID)
 }
 
-func RemindUser(sess *discordgo.Session) {
-	fmt.Println("Reminder service started.")
-
-	// Nil check for session
+// RemindUserLate sends a patient's reminders that came due while the bot was not running
+func RemindUserLate(sess *discordgo.Session, patientID string, missed []MissedReminder) {
 	if sess == nil {
 		fmt.Println("Error: Discord session is nil")
 		return
 	}
+	if len(missed) == 0 {
+		return
+	}
 
-	// Load medication schedule
-	schedule, err := LoadMedicationState()
+	doseLog, err := LoadDoseLog()
 	if err != nil {
-		fmt.Printf("Error loading medication state: %v\n", err)
-		return
+		fmt.Printf("Error loading dose log: %v\n", err)
 	}
 
-	// Update medication counts based on elapsed days
-	UpdateMedicationCounts(schedule)
+	var patient *Patient
+	err = UpdateMedicationState(func(schedule *MedicationSchedule) error {
+		// Update medication counts based on elapsed days
+		UpdateMedicationCounts(schedule, doseLog)
+		patient = schedule.Patient(patientID)
+		if patient == nil {
+			return fmt.Errorf("patient %s not found", patientID)
+		}
+		for _, m := range missed {
+			MarkReminded(patient, m.Medications, m.DueAt)
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("Error updating medication state: %v\n", err)
+		return
+	}
 
-	// Get current reminders for this time
-	loc := time.FixedZone("UTC+8", 8*3600)
-	now := time.Now().In(loc)
-	reminders := GetCurrentReminders(schedule, now)
+	for _, m := range missed {
+		fmt.Printf("Sending late reminder for %d of %s's medication(s) due at %s\n", len(m.Medications), patient.Name, m.DueAt.Format(time.RFC1123))
 
-	if len(reminders) == 0 {
-		fmt.Println("No medications due at this time.")
-		return
+		reminderID := NewReminderID()
+		if err := RecordReminder(reminderID, patient, m.Medications, m.DueAt); err != nil {
+			fmt.Printf("Error recording doses: %v\n", err)
+		}
+		deliverReminder(sess, patient, FormatLateReminderMessage(patient, m.Medications, m.DueAt), "Late Medication Reminder", reminderID)
+	}
+	if patient.SkipAcknowledgement {
+		RefreshMedicationCounts()
 	}
+}
 
-	// Format the reminder message
-	reminderMsg := FormatReminderMessage(reminders)
+// deliverReminder sends a reminder message to a patient's Discord users and emails.
+// When reminderID is set the DMs carry dose acknowledgement buttons, unless the patient
+// doesn't acknowledge doses.
+func deliverReminder(sess *discordgo.Session, patient *Patient, reminderMsg, subj, reminderID string) {
+	if len(patient.DiscordIDs) == 0 {
+		fmt.Printf("Warning: %s has no Discord users to remind\n", patient.Name)
+	}
 
-	// Send to JP (hardcoded user for medication tracking)
-	userID := JPDiscordID
-	if userID == "" {
-		fmt.Println("Error: User ID is empty")
-		return
+	var components []discordgo.MessageComponent
+	if reminderID != "" && !patient.SkipAcknowledgement {
+		components = ReminderComponents(reminderID)
 	}
 
-	// Send Discord DM asynchronously
-	go func() {
-		defer func() {
-			if r := recover(); r != nil {
-				fmt.Printf("Discord DM panic: %v\n", r)
+	for idx, userID := range patient.DiscordIDs {
+		// Send Discord DM asynchronously
+		go func(uid string, first bool) {
+			defer func() {
+				if r := recover(); r != nil {
+					fmt.Printf("Discord DM panic: %v\n", r)
+				}
+			}()
+
+			sent, err := sendDM(sess, uid, reminderMsg, components)
+			if err != nil {
+				fmt.Println(err)
+				return
 			}
-		}()
+			fmt.Printf("Sent %s to user %s\n", strings.ToLower(subj), uid)
 
-		channel, err := sess.UserChannelCreate(userID)
-		if err != nil {
-			fmt.Printf("Error creating DM channel with user %s: %v\n", userID, err)
-			return
-		}
+			// The first recipient's copy is the one tracked in the dose log
+			if reminderID != "" && first {
+				if err := RecordReminderMessage(reminderID, sent.ChannelID, sent.ID); err != nil {
+					fmt.Printf("Error recording reminder message: %v\n", err)
+				}
+			}
+		}(userID, idx == 0)
+	}
 
-		_, err = sess.ChannelMessageSend(channel.ID, reminderMsg)
-		if err != nil {
-			fmt.Printf("Error sending message to user %s: %v\n", userID, err)
-		} else {
-			fmt.Printf("Sent reminder to user %s\n", userID)
-		}
-	}()
+	if len(patient.Emails) > 0 {
+		sendEmailAsync(patient.Emails, subj, reminderMsg)
+	}
+}
+
+// sendDM sends a direct message, optionally with components, to a Discord user
+func sendDM(sess *discordgo.Session, userID, content string, components []discordgo.MessageComponent) (*discordgo.Message, error) {
+	channel, err := sess.UserChannelCreate(userID)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating DM channel with user %s: %v", userID, err)
+	}
+
+	sent, err := sess.ChannelMessageSendComplex(channel.ID, &discordgo.MessageSend{
+		Content:    content,
+		Components: components,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error sending message to user %s: %v", userID, err)
+	}
+	return sent, nil
+}
 
-	// Send emails asynchronously
+// sendEmailAsync emails a plain text copy of a Discord message in the background
+func sendEmailAsync(emails []string, subj, msg string) {
 	go func() {
 		defer func() {
 			if r := recover(); r != nil {
@@ -184,65 +235,65 @@ func RemindUser(sess *discordgo.Session) {
 			}
 		}()
 
-		// Parse and trim email addresses
-		emailList := strings.Split(JPEmails, ",")
-		var trimmedEmails []string
-		for _, email := range emailList {
-			if trimmed := strings.TrimSpace(email); trimmed != "" {
-				trimmedEmails = append(trimmedEmails, trimmed)
-			}
-		}
-
-		if len(trimmedEmails) == 0 {
+		if len(emails) == 0 {
 			fmt.Println("No valid email addresses")
 			return
 		}
 
-		subj := "Medication Reminder"
-		plainText := strings.ReplaceAll(reminderMsg, "**", "")
+		plainText := strings.ReplaceAll(msg, "**", "")
 
-		if err := sendEmail(trimmedEmails, subj, plainText); err != nil {
-			fmt.Printf("Error sending email to %v: %v\n", trimmedEmails, err)
+		if err := sendEmail(emails, subj, plainText); err != nil {
+			fmt.Printf("Error sending email to %v: %v\n", emails, err)
 		} else {
-			fmt.Printf("Sent email reminder to %v\n", trimmedEmails)
+			fmt.Printf("Sent %s email to %v\n", strings.ToLower(subj), emails)
 		}
 	}()
 }
 
+// splitEmails parses and trims a comma separated list of email addresses
+func splitEmails(list string) []string {
+	var emails []string
+	for _, email := range strings.Split(list, ",") {
+		if trimmed := strings.TrimSpace(email); trimmed != "" {
+			emails = append(emails, trimmed)
+		}
+	}
+	return emails
+}
 
 // helper to send email using github.com/jordan-wright/email
 func sendEmail(to []string, subject, body string) error {
-    host := strings.TrimSpace(os.Getenv("SMTP_HOST"))
-    port := strings.TrimSpace(os.Getenv("SMTP_PORT"))
-    user := strings.TrimSpace(os.Getenv("SMTP_USER"))
-    pass := strings.TrimSpace(os.Getenv("SMTP_PASS"))
-    from := strings.TrimSpace(os.Getenv("EMAIL_FROM"))
-    if from == "" {
-        from = user
-    }
-    if host == "" || port == "" || user == "" || pass == "" {
-        return fmt.Errorf("SMTP config missing")
-    }
-
-    addr := host + ":" + port
-    e := email.NewEmail()
-    e.From = from
-    e.To = to
-    e.Subject = subject
-    e.Text = []byte(body)
-    e.HTML = []byte(body)
-
-    auth := smtp.PlainAuth("", user, pass, host)
-
-    // Use implicit TLS for port 465, otherwise use STARTTLS (e.Send)
-    if port == "465" {
-        tlsConfig := &tls.Config{
-            InsecureSkipVerify: false,
-            ServerName:         host,
-        }
-        return e.SendWithTLS(addr, auth, tlsConfig)
-    }
-
-    // For 587 (STARTTLS) and other non-implicit-TLS ports
-    return e.Send(addr, auth)
-}
\ No newline at end of file
+	host := strings.TrimSpace(os.Getenv("SMTP_HOST"))
+	port := strings.TrimSpace(os.Getenv("SMTP_PORT"))
+	user := strings.TrimSpace(os.Getenv("SMTP_USER"))
+	pass := strings.TrimSpace(os.Getenv("SMTP_PASS"))
+	from := strings.TrimSpace(os.Getenv("EMAIL_FROM"))
+	if from == "" {
+		from = user
+	}
+	if host == "" || port == "" || user == "" || pass == "" {
+		return fmt.Errorf("SMTP config missing")
+	}
+
+	addr := host + ":" + port
+	e := email.NewEmail()
+	e.From = from
+	e.To = to
+	e.Subject = subject
+	e.Text = []byte(body)
+	e.HTML = []byte(body)
+
+	auth := smtp.PlainAuth("", user, pass, host)
+
+	// Use implicit TLS for port 465, otherwise use STARTTLS (e.Send)
+	if port == "465" {
+		tlsConfig := &tls.Config{
+			InsecureSkipVerify: false,
+			ServerName:         host,
+		}
+		return e.SendWithTLS(addr, auth, tlsConfig)
+	}
+
+	// For 587 (STARTTLS) and other non-implicit-TLS ports
+	return e.Send(addr, auth)
+}
@@ -0,0 +1,112 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// seedFile is the JSON or YAML file a new schedule starts from, an empty schedule when ""
+var seedFile string
+
+// SetSeedFile changes the file a new schedule is seeded from when nothing was saved yet.
+// The file is checked right away, so a broken seed stops the bot before it is needed.
+func SetSeedFile(path string) error {
+	path = strings.TrimSpace(path)
+	if path != "" {
+		if _, err := LoadSeedFile(path); err != nil {
+			return err
+		}
+	}
+	seedFile = path
+	return nil
+}
+
+// LoadSeedFile reads patients and their medications from a seed file. It takes the same
+// fields as medication_state.json, in JSON or, for .yaml and .yml files, YAML, so
+// medications are only reminded when they're active. Seeds without a version are
+// migrated like older state files.
+func LoadSeedFile(path string) (*MedicationSchedule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading seed file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		// YAML is turned into JSON so both formats go through the same field names and doses
+		var doc any
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("error parsing seed file %s: %w", path, err)
+		}
+		if data, err = json.Marshal(doc); err != nil {
+			return nil, fmt.Errorf("error parsing seed file %s: %w", path, err)
+		}
+	}
+
+	var schedule MedicationSchedule
+	if err := json.Unmarshal(data, &schedule); err != nil {
+		return nil, fmt.Errorf("error parsing seed file %s: %w", path, err)
+	}
+	if _, err := MigrateSchedule(&schedule); err != nil {
+		return nil, fmt.Errorf("error migrating seed file %s: %w", path, err)
+	}
+	if err := prepareSeed(&schedule, time.Now()); err != nil {
+		return nil, fmt.Errorf("invalid seed file %s: %w", path, err)
+	}
+	return &schedule, nil
+}
+
+// prepareSeed checks every seeded patient and medication, and starts the courses that
+// don't give a start now
+func prepareSeed(schedule *MedicationSchedule, now time.Time) error {
+	ids := make(map[string]bool)
+	for p := range schedule.Patients {
+		patient := &schedule.Patients[p]
+		if patient.ID == "" || patient.Name == "" {
+			return fmt.Errorf("patient %d needs an id and a name", p+1)
+		}
+		if ids[strings.ToLower(patient.ID)] {
+			return fmt.Errorf("more than one patient has the id %q", patient.ID)
+		}
+		ids[strings.ToLower(patient.ID)] = true
+		if patient.Timezone != "" {
+			if _, err := LoadTimezone(patient.Timezone); err != nil {
+				return fmt.Errorf("%s: %w", patient.Name, err)
+			}
+		}
+		if patient.Medications == nil {
+			patient.Medications = []Medication{}
+		}
+
+		names := make(map[string]bool)
+		for m := range patient.Medications {
+			med := &patient.Medications[m]
+			if med.Name == "" {
+				return fmt.Errorf("%s's medication %d needs a name", patient.Name, m+1)
+			}
+			if names[strings.ToLower(med.Name)] {
+				return fmt.Errorf("%s has more than one medication named %q", patient.Name, med.Name)
+			}
+			names[strings.ToLower(med.Name)] = true
+			if len(med.Times) > 0 {
+				if _, err := ParseTimes(strings.Join(med.Times, ",")); err != nil {
+					return fmt.Errorf("%s: %w", med.Name, err)
+				}
+			}
+			if med.Start.IsZero() {
+				med.Start = now.Truncate(time.Minute)
+			}
+			if med.Escalation != nil && med.Escalation.SetAt.IsZero() {
+				med.Escalation.SetAt = now
+			}
+			med.UpdateRemaining(patient.ID, nil, now, patient.LocationAt)
+		}
+	}
+	return nil
+}
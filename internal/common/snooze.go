@@ -0,0 +1,167 @@
+package common
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// SnoozeButtonPrefix starts the custom ID of every snooze duration button
+const SnoozeButtonPrefix = "snooze"
+
+// SnoozeChoices are the durations offered by the snooze buttons, in minutes
+var SnoozeChoices = []int{5, 10, 30}
+
+// SnoozeReminder snoozes every open dose of a reminder until the given time
+func SnoozeReminder(reminderID string, until time.Time, userID string, at time.Time) ([]DoseEntry, error) {
+	var updated []DoseEntry
+	err := UpdateDoseLog(func(log *DoseLog) error {
+		entries := log.Reminder(reminderID)
+		if len(entries) == 0 {
+			return fmt.Errorf("reminder %s not found", reminderID)
+		}
+
+		for _, entry := range entries {
+			if !entry.isOpen() {
+				continue
+			}
+			snooze(entry, until, userID, at)
+			updated = append(updated, *entry)
+		}
+		return nil
+	})
+	return updated, err
+}
+
+// SnoozeMedication snoozes the most recent open dose of a patient's medication until the given time
+func SnoozeMedication(patientID, name string, until time.Time, userID string, at time.Time) (DoseEntry, error) {
+	var updated DoseEntry
+	err := UpdateDoseLog(func(log *DoseLog) error {
+		for i := len(log.Entries) - 1; i >= 0; i-- {
+			entry := &log.Entries[i]
+			if !entryMatches(*entry, patientID, name) || !entry.isOpen() {
+				continue
+			}
+			snooze(entry, until, userID, at)
+			updated = *entry
+			return nil
+		}
+		return fmt.Errorf("there is no open %s dose to snooze", name)
+	})
+	return updated, err
+}
+
+// snooze marks a single dose as snoozed
+func snooze(entry *DoseEntry, until time.Time, userID string, at time.Time) {
+	entry.Status = DoseSnoozed
+	entry.SnoozedUntil = until
+	entry.ActedBy = userID
+	entry.ActedAt = at
+}
+
+// NextSnoozeTime returns when the earliest snoozed dose is due again
+func NextSnoozeTime(log *DoseLog) (time.Time, bool) {
+	var next time.Time
+	for _, entry := range log.Entries {
+		if entry.Status != DoseSnoozed {
+			continue
+		}
+		if next.IsZero() || entry.SnoozedUntil.Before(next) {
+			next = entry.SnoozedUntil
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// ResendDueSnoozes reminds again every snoozed dose whose snooze ended at or before now.
+// Resent doses move to a new reminder ID so the buttons on the new message only
+// act on the doses it lists.
+func ResendDueSnoozes(sess *discordgo.Session, now time.Time) {
+	if sess == nil {
+		fmt.Println("Error: Discord session is nil")
+		return
+	}
+
+	schedule, err := LoadMedicationState()
+	if err != nil {
+		fmt.Printf("Error loading medication state: %v\n", err)
+		return
+	}
+
+	resend := make(map[string][]Medication)
+	patients := make(map[string]*Patient)
+	err = UpdateDoseLog(func(log *DoseLog) error {
+		newIDs := make(map[string]string)
+		for i := range log.Entries {
+			entry := &log.Entries[i]
+			if entry.Status != DoseSnoozed || entry.SnoozedUntil.After(now) {
+				continue
+			}
+
+			patient, med, ok := findMedication(schedule, entry.Patient, entry.Medication)
+			if !ok || !med.Active {
+				// The medication was removed or finished while snoozed
+				entry.Status = DoseCancelled
+				entry.SnoozedUntil = time.Time{}
+				continue
+			}
+
+			newID, ok := newIDs[entry.ReminderID]
+			if !ok {
+				newID = NewReminderID()
+				newIDs[entry.ReminderID] = newID
+			}
+
+			// Escalation starts over from the resent reminder
+			entry.ReminderID = newID
+			entry.Status = DosePending
+			entry.SentAt = now
+			entry.SnoozedUntil = time.Time{}
+			entry.EscalationLevel = 0
+			entry.ChannelID = ""
+			entry.MessageID = ""
+			resend[newID] = append(resend[newID], med)
+			patients[newID] = patient
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("Error updating dose log: %v\n", err)
+		return
+	}
+
+	ids := make([]string, 0, len(resend))
+	for id := range resend {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		patient := patients[id]
+		fmt.Printf("Resending %d of %s's snoozed medication(s)\n", len(resend[id]), patient.Name)
+		msg := "💤 **Snoozed reminder** 💤\n\n" + FormatReminderMessage(patient, resend[id])
+		deliverReminder(sess, patient, msg, "Snoozed Medication Reminder", id)
+	}
+}
+
+// SnoozeComponents returns the buttons that pick how long to snooze a reminder
+func SnoozeComponents(reminderID string) []discordgo.MessageComponent {
+	buttons := make([]discordgo.MessageComponent, 0, len(SnoozeChoices)+1)
+	for _, minutes := range SnoozeChoices {
+		buttons = append(buttons, discordgo.Button{
+			Label:    fmt.Sprintf("%d min", minutes),
+			Style:    discordgo.PrimaryButton,
+			CustomID: fmt.Sprintf("%s:%d:%s", SnoozeButtonPrefix, minutes, reminderID),
+		})
+	}
+	buttons = append(buttons, discordgo.Button{
+		Label:    "Back",
+		Style:    discordgo.SecondaryButton,
+		CustomID: SnoozeButtonPrefix + ":back:" + reminderID,
+	})
+
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{Components: buttons},
+	}
+}
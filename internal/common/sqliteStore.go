@@ -0,0 +1,364 @@
+package common
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// defaultSQLitePath is the database file used when the config doesn't name one
+const defaultSQLitePath = "meds_reminder.db"
+
+// sqliteSchema creates the tables on first open. Patients, medications and doses keep
+// their full JSON in data, with the columns they're looked up by next to it.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS patients (
+	id       TEXT PRIMARY KEY,
+	position INTEGER NOT NULL,
+	name     TEXT NOT NULL,
+	data     TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS medications (
+	patient_id TEXT NOT NULL REFERENCES patients(id) ON DELETE CASCADE,
+	position   INTEGER NOT NULL,
+	name       TEXT NOT NULL,
+	active     INTEGER NOT NULL,
+	data       TEXT NOT NULL,
+	PRIMARY KEY (patient_id, position)
+);
+CREATE TABLE IF NOT EXISTS dose_log (
+	id          INTEGER PRIMARY KEY,
+	reminder_id TEXT NOT NULL,
+	patient     TEXT NOT NULL,
+	medication  TEXT NOT NULL,
+	due_at      TEXT NOT NULL,
+	status      TEXT NOT NULL,
+	data        TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS dose_log_patient ON dose_log (patient, medication, due_at);
+CREATE INDEX IF NOT EXISTS dose_log_reminder ON dose_log (reminder_id);
+CREATE TABLE IF NOT EXISTS settings (
+	key   TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);
+`
+
+// Keys of the settings table holding the schedule's LastUpdated and Version, which have
+// no table of their own
+const (
+	lastUpdatedSetting   = "last_updated"
+	schemaVersionSetting = "schema_version"
+)
+
+// SQLiteStore keeps the state in an embedded SQLite database
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// OpenSQLiteStore opens or creates the database at path
+func OpenSQLiteStore(path string) (*SQLiteStore, error) {
+	if path == "" {
+		path = defaultSQLitePath
+	}
+	db, err := sql.Open("sqlite", path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+	// One connection keeps writes in order, SQLite only takes one writer at a time anyway
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error creating database tables: %w", err)
+	}
+	return &SQLiteStore{db: db}, nil
+}
+
+// openSQLiteReadOnly opens an existing database for reading, without creating it, its
+// tables or anything else
+func openSQLiteReadOnly(path string) (*SQLiteStore, error) {
+	if path == "" {
+		path = defaultSQLitePath
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("error opening database: %w", err)
+	}
+	// Without a write-ahead log nobody has the database open, and reading it as immutable
+	// keeps SQLite from creating the log and its index next to it
+	mode := "mode=ro&_pragma=busy_timeout(5000)"
+	if _, err := os.Stat(path + "-wal"); os.IsNotExist(err) {
+		mode = "mode=ro&immutable=1"
+	}
+	db, err := sql.Open("sqlite", "file:"+path+"?"+mode)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	return &SQLiteStore{db: db}, nil
+}
+
+// LoadSchedule reads every patient and their medications in the order they were saved
+func (s *SQLiteStore) LoadSchedule() (*MedicationSchedule, error) {
+	lastUpdated, saved, err := s.Setting(lastUpdatedSetting)
+	if err != nil || !saved {
+		return nil, err
+	}
+	schedule := &MedicationSchedule{Patients: []Patient{}, LastUpdated: lastUpdated}
+	if version, saved, err := s.Setting(schemaVersionSetting); err != nil {
+		return nil, err
+	} else if saved {
+		if schedule.Version, err = strconv.Atoi(version); err != nil {
+			return nil, fmt.Errorf("error reading schema version %q: %w", version, err)
+		}
+	}
+
+	rows, err := s.db.Query(`SELECT data FROM patients ORDER BY position`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	index := make(map[string]int)
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var patient Patient
+		if err := json.Unmarshal([]byte(data), &patient); err != nil {
+			return nil, err
+		}
+		patient.Medications = []Medication{}
+		index[patient.ID] = len(schedule.Patients)
+		schedule.Patients = append(schedule.Patients, patient)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// The only connection is needed for the next query
+	rows.Close()
+
+	medRows, err := s.db.Query(`SELECT patient_id, data FROM medications ORDER BY patient_id, position`)
+	if err != nil {
+		return nil, err
+	}
+	defer medRows.Close()
+	for medRows.Next() {
+		var patientID, data string
+		if err := medRows.Scan(&patientID, &data); err != nil {
+			return nil, err
+		}
+		var med Medication
+		if err := json.Unmarshal([]byte(data), &med); err != nil {
+			return nil, err
+		}
+		p, ok := index[patientID]
+		if !ok {
+			continue
+		}
+		schedule.Patients[p].Medications = append(schedule.Patients[p].Medications, med)
+	}
+	return schedule, medRows.Err()
+}
+
+// SaveSchedule replaces every patient and medication in one transaction
+func (s *SQLiteStore) SaveSchedule(schedule *MedicationSchedule) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM medications`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM patients`); err != nil {
+		return err
+	}
+	for p, patient := range schedule.Patients {
+		if err := savePatient(tx, p, patient); err != nil {
+			return err
+		}
+		for m, med := range patient.Medications {
+			if err := saveMedication(tx, patient.ID, m, med); err != nil {
+				return err
+			}
+		}
+	}
+	if err := saveScheduleInfo(tx, schedule.Version, schedule.LastUpdated); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SaveScheduleChanges writes only the patients and medications that changed, in one transaction
+func (s *SQLiteStore) SaveScheduleChanges(changes *ScheduleChanges) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, id := range changes.RemovedPatients {
+		if _, err := tx.Exec(`DELETE FROM medications WHERE patient_id = ?`, id); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM patients WHERE id = ?`, id); err != nil {
+			return err
+		}
+	}
+	for _, change := range changes.Patients {
+		if err := savePatient(tx, change.Position, change.Patient); err != nil {
+			return err
+		}
+	}
+	for id, count := range changes.MedicationCounts {
+		if _, err := tx.Exec(`DELETE FROM medications WHERE patient_id = ? AND position >= ?`, id, count); err != nil {
+			return err
+		}
+	}
+	for _, change := range changes.Medications {
+		if err := saveMedication(tx, change.PatientID, change.Position, change.Medication); err != nil {
+			return err
+		}
+	}
+	if err := saveScheduleInfo(tx, changes.Version, changes.LastUpdated); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// savePatient inserts or updates one patient's own fields
+func savePatient(tx *sql.Tx, position int, patient Patient) error {
+	patient.Medications = nil
+	data, err := json.Marshal(patient)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO patients (id, position, name, data) VALUES (?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET position = excluded.position, name = excluded.name, data = excluded.data`,
+		patient.ID, position, patient.Name, string(data)); err != nil {
+		return fmt.Errorf("error saving patient %s: %w", patient.ID, err)
+	}
+	return nil
+}
+
+// saveMedication inserts or updates the medication at a position in a patient's list
+func saveMedication(tx *sql.Tx, patientID string, position int, med Medication) error {
+	data, err := json.Marshal(med)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO medications (patient_id, position, name, active, data) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (patient_id, position) DO UPDATE SET name = excluded.name, active = excluded.active, data = excluded.data`,
+		patientID, position, med.Name, med.Active, string(data)); err != nil {
+		return fmt.Errorf("error saving medication %s: %w", med.Name, err)
+	}
+	return nil
+}
+
+// saveScheduleInfo writes the schedule's version and last update as part of a transaction
+func saveScheduleInfo(tx *sql.Tx, version int, lastUpdated string) error {
+	if err := setSetting(tx, lastUpdatedSetting, lastUpdated); err != nil {
+		return err
+	}
+	return setSetting(tx, schemaVersionSetting, strconv.Itoa(version))
+}
+
+// LoadDoseLog reads every logged dose in the order it was reminded
+func (s *SQLiteStore) LoadDoseLog() (*DoseLog, error) {
+	rows, err := s.db.Query(`SELECT data FROM dose_log ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	log := &DoseLog{}
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var entry DoseEntry
+		if err := json.Unmarshal([]byte(data), &entry); err != nil {
+			return nil, err
+		}
+		log.Entries = append(log.Entries, entry)
+	}
+	return log, rows.Err()
+}
+
+// SaveDoseChanges updates the changed doses and appends the new ones in one transaction.
+// Entries keep their position in the log as their row.
+func (s *SQLiteStore) SaveDoseChanges(changes *DoseChanges) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for idx, e := range changes.Updated {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		result, err := tx.Exec(`UPDATE dose_log SET reminder_id = ?, patient = ?, medication = ?, due_at = ?, status = ?, data = ? WHERE id = ?`,
+			e.ReminderID, e.Patient, e.Medication, e.DueAt.UTC().Format(time.RFC3339), string(e.Status), string(data), idx+1)
+		if err != nil {
+			return fmt.Errorf("error saving dose of %s: %w", e.Medication, err)
+		}
+		if n, err := result.RowsAffected(); err == nil && n == 0 {
+			return fmt.Errorf("dose %d isn't in the log", idx)
+		}
+	}
+	for _, e := range changes.Appended {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		// Doses are never removed, so the next row is the next position
+		if _, err := tx.Exec(`INSERT INTO dose_log (reminder_id, patient, medication, due_at, status, data) VALUES (?, ?, ?, ?, ?, ?)`,
+			e.ReminderID, e.Patient, e.Medication, e.DueAt.UTC().Format(time.RFC3339), string(e.Status), string(data)); err != nil {
+			return fmt.Errorf("error saving dose of %s: %w", e.Medication, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// Setting reads a value from the settings table, and whether it was saved
+func (s *SQLiteStore) Setting(key string) (string, bool, error) {
+	var value string
+	err := s.db.QueryRow(`SELECT value FROM settings WHERE key = ?`, key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+// SetSetting saves a value in the settings table. The schedule's own values are only
+// written along with the schedule.
+func (s *SQLiteStore) SetSetting(key, value string) error {
+	if key == lastUpdatedSetting || key == schemaVersionSetting {
+		return fmt.Errorf("setting %s is saved with the schedule", key)
+	}
+	_, err := s.db.Exec(`INSERT INTO settings (key, value) VALUES (?, ?) ON CONFLICT (key) DO UPDATE SET value = excluded.value`, key, value)
+	return err
+}
+
+// Close closes the database
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// setSetting writes one of the schedule's own values as part of a transaction
+func setSetting(tx *sql.Tx, key, value string) error {
+	_, err := tx.Exec(`INSERT INTO settings (key, value) VALUES (?, ?) ON CONFLICT (key) DO UPDATE SET value = excluded.value`, key, value)
+	return err
+}
@@ -0,0 +1,99 @@
+package common
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// StateRecovery describes a state file that couldn't be read
+type StateRecovery struct {
+	Path   string
+	Err    error     // why the file couldn't be read
+	Backup string    // the backup it was restored from, empty when none could be read
+	Moved  string    // where the unreadable file was moved to, if it existed
+	At     time.Time // when it happened
+}
+
+var (
+	recoveryMutex sync.Mutex
+	// recoveryHandlers are told about every unreadable state file
+	recoveryHandlers []func(StateRecovery)
+	// pendingRecoveries happened before any handler was registered, e.g. while starting up
+	pendingRecoveries []StateRecovery
+)
+
+// OnStateRecovery registers a callback that runs whenever a state file couldn't be read,
+// including the times it happened before the callback was registered
+func OnStateRecovery(fn func(StateRecovery)) {
+	recoveryMutex.Lock()
+	recoveryHandlers = append(recoveryHandlers, fn)
+	pending := pendingRecoveries
+	pendingRecoveries = nil
+	recoveryMutex.Unlock()
+
+	for _, r := range pending {
+		fn(r)
+	}
+}
+
+// reportRecovery logs an unreadable state file and tells the registered callbacks
+func reportRecovery(r StateRecovery) {
+	if r.Backup != "" {
+		fmt.Printf("ALERT: %s was unreadable (%v), restored it from %s\n", r.Path, r.Err, r.Backup)
+	} else {
+		fmt.Printf("ALERT: %s is unreadable (%v) and no backup could be read\n", r.Path, r.Err)
+	}
+
+	recoveryMutex.Lock()
+	handlers := append([]func(StateRecovery){}, recoveryHandlers...)
+	if len(handlers) == 0 {
+		pendingRecoveries = append(pendingRecoveries, r)
+	}
+	recoveryMutex.Unlock()
+
+	for _, fn := range handlers {
+		fn(r)
+	}
+}
+
+// SendRecoveryAlert tells the admins that a state file was unreadable, and whether it
+// could be restored from a backup
+func SendRecoveryAlert(sess *discordgo.Session, adminIDs []string, r StateRecovery) {
+	if sess == nil {
+		fmt.Println("Error: Discord session is nil")
+		return
+	}
+	if len(adminIDs) == 0 {
+		fmt.Println("No ADMIN_IDS configured, the state file alert was only logged")
+		return
+	}
+
+	msg := "🚨 **State file problem** 🚨\n\n"
+	msg += fmt.Sprintf("`%s` couldn't be read at %s:\n```\n%v\n```\n", r.Path, r.At.Format("Jan 2 15:04:05 MST"), r.Err)
+	if r.Backup != "" {
+		msg += fmt.Sprintf("✅ It was restored from the backup `%s`. Changes made after that backup was taken are lost, please check the schedule with `/schedule`.\n", r.Backup)
+	} else {
+		msg += "❌ No backup could be read either, so reminders are stopped until the file is fixed.\n"
+	}
+	if r.Moved != "" {
+		msg += fmt.Sprintf("The unreadable file was kept as `%s`.", r.Moved)
+	}
+
+	for _, userID := range adminIDs {
+		go func(uid string) {
+			defer func() {
+				if r := recover(); r != nil {
+					fmt.Printf("Discord DM panic: %v\n", r)
+				}
+			}()
+			if _, err := sendDM(sess, uid, msg, nil); err != nil {
+				fmt.Println(err)
+			} else {
+				fmt.Printf("Sent state file alert to admin %s\n", uid)
+			}
+		}(userID)
+	}
+}
@@ -0,0 +1,171 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrNoChanges ends an UpdateMedicationState transaction without saving, for changes
+// that turned out to be unneeded
+var ErrNoChanges = errors.New("no changes")
+
+// StateService owns the medication schedule in memory. Readers get their own copy, and
+// every change runs as a transaction on a copy that only replaces the schedule once it
+// was saved, so changes made at the same time can't overwrite each other.
+type StateService struct {
+	mutex    sync.Mutex
+	store    Store
+	schedule *MedicationSchedule // nil until first loaded
+}
+
+// NewStateService returns a service keeping the schedule in store
+func NewStateService(store Store) *StateService {
+	return &StateService{store: store}
+}
+
+// states is the service behind LoadMedicationState and UpdateMedicationState
+var states = NewStateService(store)
+
+// Snapshot returns a copy of the schedule, changes to it aren't saved
+func (s *StateService) Snapshot() (*MedicationSchedule, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return cloneSchedule(s.schedule)
+}
+
+// Update runs fn on a copy of the schedule and saves it, one transaction at a time. When
+// fn returns an error nothing is saved and the error is returned, except ErrNoChanges,
+// which is not an error. The state change callbacks run once the change was saved.
+func (s *StateService) Update(fn func(schedule *MedicationSchedule) error) error {
+	changed, err := s.update(fn)
+	if err != nil || !changed {
+		return err
+	}
+	notifyStateChange()
+	return nil
+}
+
+// update runs a transaction and reports whether it saved a change
+func (s *StateService) update(fn func(schedule *MedicationSchedule) error) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.load(); err != nil {
+		return false, fmt.Errorf("error loading medication schedule: %w", err)
+	}
+	working, err := cloneSchedule(s.schedule)
+	if err != nil {
+		return false, err
+	}
+	if err := fn(working); err != nil {
+		if errors.Is(err, ErrNoChanges) {
+			return false, nil
+		}
+		return false, err
+	}
+	saved, err := s.saveChanges(working)
+	if err != nil {
+		return false, fmt.Errorf("error saving medication schedule: %w", err)
+	}
+	return saved, nil
+}
+
+// reset forgets the schedule held in memory, so the next read loads it from store
+func (s *StateService) reset(store Store) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.store = store
+	s.schedule = nil
+}
+
+// load reads the schedule from the store the first time it's needed, starting from the
+// seed file or an empty schedule when nothing was saved yet. Older schedules are migrated and saved
+// straight away, so the store's backups keep the version from before the migration.
+// The caller must hold the mutex.
+func (s *StateService) load() error {
+	if s.schedule != nil {
+		return nil
+	}
+
+	schedule, err := s.store.LoadSchedule()
+	if err != nil {
+		return err
+	}
+	if schedule == nil {
+		if schedule, err = initializeDefaultSchedule(); err != nil {
+			return err
+		}
+		return s.save(schedule)
+	}
+
+	migrated, err := migrateLoaded(schedule)
+	if err != nil {
+		return err
+	}
+	if migrated {
+		return s.save(schedule)
+	}
+	s.schedule = schedule
+	return nil
+}
+
+// save writes a whole schedule to the store, when it is seeded or migrated, and keeps a copy of it as the current one, so
+// whoever built it can't change the current schedule afterwards. The caller must hold
+// the mutex.
+func (s *StateService) save(schedule *MedicationSchedule) error {
+	schedule.Version = SchemaVersion
+	schedule.LastUpdated = time.Now().Format(time.RFC3339)
+	current, err := cloneSchedule(schedule)
+	if err != nil {
+		return err
+	}
+	if err := s.store.SaveSchedule(schedule); err != nil {
+		return err
+	}
+	s.schedule = current
+	return nil
+}
+
+// saveChanges writes the patients and medications a transaction changed and keeps a copy
+// of the schedule as the current one, reporting whether anything changed. The caller
+// must hold the mutex.
+func (s *StateService) saveChanges(schedule *MedicationSchedule) (bool, error) {
+	schedule.Version = SchemaVersion
+	schedule.LastUpdated = time.Now().Format(time.RFC3339)
+	changes, err := diffSchedule(s.schedule, schedule)
+	if err != nil {
+		return false, err
+	}
+	if changes.Empty() {
+		return false, nil
+	}
+	current, err := cloneSchedule(schedule)
+	if err != nil {
+		return false, err
+	}
+	if err := s.store.SaveScheduleChanges(changes); err != nil {
+		return false, err
+	}
+	s.schedule = current
+	return true, nil
+}
+
+// cloneSchedule deep copies a schedule through its JSON form, which every field survives
+func cloneSchedule(schedule *MedicationSchedule) (*MedicationSchedule, error) {
+	data, err := json.Marshal(schedule)
+	if err != nil {
+		return nil, err
+	}
+	var clone MedicationSchedule
+	if err := json.Unmarshal(data, &clone); err != nil {
+		return nil, err
+	}
+	return &clone, nil
+}
@@ -0,0 +1,315 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// countingStore counts the schedules and changes saved to the store it wraps
+type countingStore struct {
+	Store
+	saves atomic.Int64
+}
+
+func (s *countingStore) SaveSchedule(schedule *MedicationSchedule) error {
+	s.saves.Add(1)
+	return s.Store.SaveSchedule(schedule)
+}
+
+func (s *countingStore) SaveScheduleChanges(changes *ScheduleChanges) error {
+	s.saves.Add(1)
+	return s.Store.SaveScheduleChanges(changes)
+}
+
+// newTestStore returns a JSON store in a fresh temporary directory
+func newTestStore(t *testing.T) *countingStore {
+	t.Helper()
+	dir := t.TempDir()
+	return &countingStore{Store: NewJSONStore(
+		filepath.Join(dir, stateFile),
+		filepath.Join(dir, doseLogFile),
+		filepath.Join(dir, settingsFile),
+		2,
+	)}
+}
+
+// newTestService returns a service holding one patient without medications
+func newTestService(t *testing.T) (*StateService, *countingStore) {
+	t.Helper()
+	store := newTestStore(t)
+	schedule := &MedicationSchedule{Version: SchemaVersion, Patients: []Patient{{ID: "diluc", Name: "Diluc", Medications: []Medication{}}}}
+	if err := store.SaveSchedule(schedule); err != nil {
+		t.Fatalf("seeding store: %v", err)
+	}
+	store.saves.Store(0)
+	return NewStateService(store), store
+}
+
+func TestUpdateConcurrentKeepsEveryChange(t *testing.T) {
+	service, store := newTestService(t)
+
+	const workers, updates = 16, 25
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for u := 0; u < updates; u++ {
+				err := service.Update(func(schedule *MedicationSchedule) error {
+					patient := schedule.Patient("diluc")
+					if patient.LastFired == nil {
+						patient.LastFired = make(map[string]string)
+					}
+					patient.LastFired[fmt.Sprintf("%d-%d", w, u)] = "sent"
+					return nil
+				})
+				if err != nil {
+					t.Errorf("update: %v", err)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	want := workers * updates
+	schedule, err := service.Snapshot()
+	if err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	if got := len(schedule.Patient("diluc").LastFired); got != want {
+		t.Errorf("in memory: got %d changes, want %d", got, want)
+	}
+	if got := store.saves.Load(); got != int64(want) {
+		t.Errorf("got %d saves, want %d", got, want)
+	}
+
+	// A fresh service sees every change in the store too
+	reloaded, err := NewStateService(store).Snapshot()
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if got := len(reloaded.Patient("diluc").LastFired); got != want {
+		t.Errorf("in store: got %d changes, want %d", got, want)
+	}
+}
+
+func TestUpdateConcurrentWithReaders(t *testing.T) {
+	service, _ := newTestService(t)
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(2)
+		go func(w int) {
+			defer wg.Done()
+			for u := 0; u < 20; u++ {
+				err := service.Update(func(schedule *MedicationSchedule) error {
+					patient := schedule.Patient("diluc")
+					patient.Medications = append(patient.Medications, Medication{Name: fmt.Sprintf("med-%d-%d", w, u), Active: true})
+					return nil
+				})
+				if err != nil {
+					t.Errorf("update: %v", err)
+				}
+			}
+		}(w)
+		go func() {
+			defer wg.Done()
+			for r := 0; r < 20; r++ {
+				schedule, err := service.Snapshot()
+				if err != nil {
+					t.Errorf("snapshot: %v", err)
+					return
+				}
+				// Readers own their copy, changing it must not race with anyone
+				patient := schedule.Patient("diluc")
+				for i := range patient.Medications {
+					patient.Medications[i].Active = false
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	schedule, err := service.Snapshot()
+	if err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	meds := schedule.Patient("diluc").Medications
+	if len(meds) != 8*20 {
+		t.Fatalf("got %d medications, want %d", len(meds), 8*20)
+	}
+	for _, med := range meds {
+		if !med.Active {
+			t.Fatalf("a reader's change to its copy reached %s", med.Name)
+		}
+	}
+}
+
+func TestUpdateErrorDiscardsChanges(t *testing.T) {
+	service, store := newTestService(t)
+
+	errInvalid := errors.New("invalid")
+	err := service.Update(func(schedule *MedicationSchedule) error {
+		schedule.Patient("diluc").Name = "Changed"
+		return errInvalid
+	})
+	if !errors.Is(err, errInvalid) {
+		t.Fatalf("got error %v, want %v", err, errInvalid)
+	}
+
+	schedule, err := service.Snapshot()
+	if err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	if name := schedule.Patient("diluc").Name; name != "Diluc" {
+		t.Errorf("failed transaction changed the name to %q", name)
+	}
+	if got := store.saves.Load(); got != 0 {
+		t.Errorf("failed transaction saved %d times", got)
+	}
+}
+
+func TestUpdateNoChangesSkipsSave(t *testing.T) {
+	service, store := newTestService(t)
+
+	err := service.Update(func(schedule *MedicationSchedule) error {
+		schedule.Patient("diluc").Name = "Changed"
+		return ErrNoChanges
+	})
+	if err != nil {
+		t.Fatalf("ErrNoChanges returned %v", err)
+	}
+
+	schedule, err := service.Snapshot()
+	if err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	if name := schedule.Patient("diluc").Name; name != "Diluc" {
+		t.Errorf("unsaved transaction changed the name to %q", name)
+	}
+	if got := store.saves.Load(); got != 0 {
+		t.Errorf("unsaved transaction saved %d times", got)
+	}
+}
+
+func TestUpdateEscapedPointerCantChangeState(t *testing.T) {
+	service, _ := newTestService(t)
+
+	var escaped *Patient
+	err := service.Update(func(schedule *MedicationSchedule) error {
+		escaped = schedule.Patient("diluc")
+		escaped.Name = "Saved"
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	escaped.Name = "Changed afterwards"
+
+	schedule, err := service.Snapshot()
+	if err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	if name := schedule.Patient("diluc").Name; name != "Saved" {
+		t.Errorf("got name %q, want the saved one", name)
+	}
+}
+
+func TestFirstLoadSeedsOnce(t *testing.T) {
+	seed := filepath.Join(t.TempDir(), "seed.yaml")
+	yaml := "patients:\n  - id: rex\n    name: Rex\n    medications:\n      - name: Vitamin\n        dose: 1 tab\n        times: [\"08:00\"]\n        active: true\n"
+	if err := os.WriteFile(seed, []byte(yaml), 0644); err != nil {
+		t.Fatalf("writing seed: %v", err)
+	}
+	if err := SetSeedFile(seed); err != nil {
+		t.Fatalf("seed file: %v", err)
+	}
+	t.Cleanup(func() { SetSeedFile("") })
+
+	store := newTestStore(t)
+	service := NewStateService(store)
+
+	var wg sync.WaitGroup
+	for r := 0; r < 16; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			schedule, err := service.Snapshot()
+			if err != nil {
+				t.Errorf("snapshot: %v", err)
+				return
+			}
+			if patient := schedule.Patient("rex"); patient == nil || len(patient.Medications) != 1 {
+				t.Errorf("got %+v, want the seeded patient", schedule.Patients)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := store.saves.Load(); got != 1 {
+		t.Errorf("seeded schedule saved %d times, want once", got)
+	}
+}
+
+func TestPackageStateConcurrent(t *testing.T) {
+	store := newTestStore(t)
+	if err := store.SaveSchedule(&MedicationSchedule{Version: SchemaVersion, Patients: []Patient{{ID: "diluc", Name: "Diluc"}}}); err != nil {
+		t.Fatalf("seeding store: %v", err)
+	}
+	SetStore(store)
+	t.Cleanup(func() { SetStore(NewJSONStore(stateFile, doseLogFile, settingsFile, defaultStateBackups)) })
+
+	before, err := LoadMedicationState()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	base := len(before.Patients[0].SimpleReminderTimes)
+
+	var notified atomic.Int64
+	OnStateChange(func() { notified.Add(1) })
+
+	const workers, updates = 8, 10
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(2)
+		go func(w int) {
+			defer wg.Done()
+			for u := 0; u < updates; u++ {
+				err := UpdateMedicationState(func(schedule *MedicationSchedule) error {
+					patient := &schedule.Patients[0]
+					patient.SimpleReminderTimes = append(patient.SimpleReminderTimes, fmt.Sprintf("%02d:%02d", w, u))
+					return nil
+				})
+				if err != nil {
+					t.Errorf("update: %v", err)
+				}
+			}
+		}(w)
+		go func() {
+			defer wg.Done()
+			for r := 0; r < updates; r++ {
+				if _, err := LoadMedicationState(); err != nil {
+					t.Errorf("load: %v", err)
+				}
+				RefreshMedicationCounts()
+			}
+		}()
+	}
+	wg.Wait()
+
+	schedule, err := LoadMedicationState()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if got := len(schedule.Patients[0].SimpleReminderTimes) - base; got != workers*updates {
+		t.Errorf("got %d reminder times, want %d", got, workers*updates)
+	}
+	if got := notified.Load(); got < workers*updates {
+		t.Errorf("state change callbacks ran %d times, want at least %d", got, workers*updates)
+	}
+}
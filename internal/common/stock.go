@@ -0,0 +1,278 @@
+package common
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Stock tracks how much of a medication is on hand. Doses given since the supply was
+// counted are taken off Amount, so it only changes when a new bottle is recorded.
+type Stock struct {
+	Amount  Rational  `json:"amount"` // on hand at Since
+	Unit    string    `json:"unit,omitempty"`
+	PerDose Rational  `json:"per_dose"` // used by doses whose amount isn't in Unit
+	Since   time.Time `json:"since"`
+	// AlertDays sends a refill alert once fewer days of supply are left, defaultRefillAlertDays when 0
+	AlertDays int `json:"alert_days,omitempty"`
+	// AlertedAt is when the refill alert for this supply was sent
+	AlertedAt time.Time `json:"alerted_at,omitempty"`
+}
+
+// defaultRefillAlertDays is how many days ahead a refill alert goes out by default
+const defaultRefillAlertDays = 3
+
+// maxProjectedDoses bounds how far ahead a run-out date is looked for
+const maxProjectedDoses = 5000
+
+// StockStatus is a medication's supply as of now
+type StockStatus struct {
+	Left      Rational
+	RunOut    time.Time // the first dose there isn't enough left for
+	Projected bool      // false when no run-out date can be found, e.g. for as-needed medications
+	DaysLeft  int
+	Low       bool
+}
+
+// RefillAlertDays returns the days of supply below which a refill alert is sent
+func (s Stock) RefillAlertDays() int {
+	if s.AlertDays > 0 {
+		return s.AlertDays
+	}
+	return defaultRefillAlertDays
+}
+
+// Format renders an amount in the stock's unit, e.g. "68 ml" or "7 1/2 tab"
+func (s Stock) Format(amount Rational) string {
+	text := amount.String()
+	if decimal, ok := amount.Decimal(); ok && !DoseUnit(s.Unit).countable() {
+		text = decimal
+	}
+	if s.Unit == "" {
+		return text
+	}
+	return text + " " + s.Unit
+}
+
+// doseAmount returns how much of the supply a dose uses: its amount when it's in the
+// stock's unit, PerDose otherwise
+func (s Stock) doseAmount(dose Dose) Rational {
+	if dose.Structured() && string(dose.Unit) == s.Unit {
+		return dose.Amount
+	}
+	return s.PerDose
+}
+
+// givenAmount returns how much of the supply a logged dose used, from the dose it was
+// logged with so a taper's smaller doses count as such
+func (s Stock) givenAmount(e DoseEntry) Rational {
+	dose, err := ParseDose(e.Dose)
+	if err != nil {
+		return s.PerDose
+	}
+	return s.doseAmount(dose)
+}
+
+// givenAt returns when a logged dose was given, or false when it wasn't
+func givenAt(e DoseEntry) (time.Time, bool) {
+	switch e.Status {
+	case DoseTaken:
+		return e.ActedAt, true
+	case DoseSent:
+		return e.SentAt, true
+	}
+	return time.Time{}, false
+}
+
+// StockLeft returns how much of the supply is left after the doses given since it was counted
+func (m Medication) StockLeft(patientID string, log *DoseLog) Rational {
+	if m.Stock == nil {
+		return Rational{}
+	}
+	left := m.Stock.Amount
+	if log != nil {
+		for _, e := range log.Entries {
+			if !entryMatches(e, patientID, m.Name) {
+				continue
+			}
+			if at, ok := givenAt(e); ok && !at.Before(m.Stock.Since) {
+				next, err := left.Sub(m.Stock.givenAmount(e))
+				if err != nil {
+					fmt.Printf("Error counting %s's supply: %v\n", m.Name, err)
+					return Rational{}
+				}
+				left = next
+			}
+		}
+	}
+	if left.Cmp(Rational{}) < 0 {
+		return Rational{}
+	}
+	return left
+}
+
+// StockStatus projects when the supply runs out from the upcoming doses, each using the
+// amount of its day's dose
+func (m Medication) StockStatus(patientID string, log *DoseLog, now time.Time, zone Locator) StockStatus {
+	if m.Stock == nil {
+		return StockStatus{}
+	}
+	status := StockStatus{Left: m.StockLeft(patientID, log)}
+	if m.Stock.PerDose.Cmp(Rational{}) <= 0 {
+		return status
+	}
+
+	switch {
+	case m.PRN != nil:
+	case m.Interval != nil:
+		if first, ok := m.NextIntervalDose(patientID, log, now); ok {
+			// The supply covers this many more doses, the next one is where it runs out
+			covered, err := status.Left.Div(m.Stock.doseAmount(m.Dose))
+			if err != nil {
+				fmt.Printf("Error projecting %s's supply: %v\n", m.Name, err)
+				break
+			}
+			status.RunOut = first.Add(time.Duration(covered.Floor()) * m.Interval.Every())
+			status.Projected = true
+		}
+	default:
+		left := status.Left
+		at := now
+		var err error
+		for i := 0; i < maxProjectedDoses; i++ {
+			next, ok := m.NextDoseTime(at, zone)
+			if !ok {
+				// Without a dose left to run out on, the supply lasts the course
+				break
+			}
+			at = next
+			need := m.Stock.doseAmount(m.OnDay(next, zone).Dose)
+			if left.Cmp(need) < 0 {
+				status.RunOut, status.Projected = next, true
+				break
+			}
+			if left, err = left.Sub(need); err != nil {
+				fmt.Printf("Error projecting %s's supply: %v\n", m.Name, err)
+				break
+			}
+		}
+	}
+
+	if status.Projected {
+		status.DaysLeft = int(status.RunOut.Sub(now).Hours() / 24)
+		status.Low = status.DaysLeft < m.Stock.RefillAlertDays()
+	}
+	if status.Left.Cmp(m.Stock.doseAmount(m.OnDay(now, zone).Dose)) < 0 {
+		status.Low = true
+	}
+	return status
+}
+
+// FormatStock describes a medication's supply, e.g. "68 ml left (17 doses of 4 ml), runs out Mon, Oct 30 08:00 (8 days)"
+func FormatStock(med Medication, status StockStatus, zone Locator) string {
+	stock := med.Stock
+	text := fmt.Sprintf("%s left", stock.Format(status.Left))
+	perDose := stock.doseAmount(med.Dose)
+	if perDose.Cmp(Rational{}) > 0 {
+		if doses, err := status.Left.Div(perDose); err == nil {
+			text += fmt.Sprintf(" (%d doses of %s)", doses.Floor(), stock.Format(perDose))
+		}
+	}
+	switch {
+	case status.Projected:
+		text += fmt.Sprintf(", runs out %s (%d days)", status.RunOut.In(zone(status.RunOut)).Format("Mon, Jan 2 15:04"), status.DaysLeft)
+	case med.PRN == nil && stock.PerDose.Cmp(Rational{}) > 0:
+		text += ", enough for the rest of the course"
+	}
+	if status.Low {
+		text += " ⚠️ refill soon"
+	}
+	return text
+}
+
+// CheckStock sends a refill alert for each of a patient's medications whose supply runs
+// low, once per supply, to the medication's caregivers or else the patient
+func CheckStock(sess *discordgo.Session, patientID string) {
+	if sess == nil {
+		fmt.Println("Error: Discord session is nil")
+		return
+	}
+
+	doseLog, err := LoadDoseLog()
+	if err != nil {
+		fmt.Printf("Error loading dose log: %v\n", err)
+		return
+	}
+
+	// Marking the alerts sent is saved before they go out, so two checks at once can't
+	// both send them
+	type refillAlert struct {
+		med    Medication
+		status StockStatus
+	}
+	var patient *Patient
+	var alerts []refillAlert
+	err = UpdateMedicationState(func(schedule *MedicationSchedule) error {
+		patient = schedule.Patient(patientID)
+		if patient == nil {
+			return ErrNoChanges
+		}
+
+		now := time.Now()
+		for i := range patient.Medications {
+			med := &patient.Medications[i]
+			if !med.Active || med.Stock == nil || !med.Stock.AlertedAt.IsZero() {
+				continue
+			}
+			status := med.StockStatus(patient.ID, doseLog, now, patient.LocationAt)
+			if !status.Low {
+				continue
+			}
+
+			med.Stock.AlertedAt = now
+			alerts = append(alerts, refillAlert{med: *med, status: status})
+		}
+		if len(alerts) == 0 {
+			return ErrNoChanges
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("Error saving medication state: %v\n", err)
+		return
+	}
+
+	for _, alert := range alerts {
+		sendRefillAlert(sess, patient, alert.med, alert.status)
+	}
+}
+
+// sendRefillAlert tells the caregivers of a medication, or the patient when it has none, to refill it
+func sendRefillAlert(sess *discordgo.Session, patient *Patient, med Medication, status StockStatus) {
+	msg := fmt.Sprintf("📦 **Refill needed: %s** 📦\n\n", med.Name)
+	msg += fmt.Sprintf("%s's supply is running low: %s.\n", patient.Name, FormatStock(med, status, patient.LocationAt))
+	msg += "Record the new supply with `/stock set` once it's refilled."
+
+	recipients := patient.DiscordIDs
+	if med.Escalation != nil && len(med.Escalation.CaregiverIDs) > 0 {
+		recipients = med.Escalation.CaregiverIDs
+	}
+	for _, userID := range recipients {
+		go func(uid string) {
+			defer func() {
+				if r := recover(); r != nil {
+					fmt.Printf("Discord DM panic: %v\n", r)
+				}
+			}()
+			if _, err := sendDM(sess, uid, msg, nil); err != nil {
+				fmt.Println(err)
+			} else {
+				fmt.Printf("Sent refill alert for %s to user %s\n", med.Name, uid)
+			}
+		}(userID)
+	}
+	if med.Escalation != nil && med.Escalation.EmailCaregivers {
+		sendEmailAsync(patient.Emails, "Medication Refill Needed", msg)
+	}
+}
@@ -0,0 +1,73 @@
+package common
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestStockLeftUsesLoggedDoses(t *testing.T) {
+	since := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	med := Medication{Name: "A1", Dose: MustParseDose("1/2 tab"), Stock: &Stock{Amount: NewRational(10, 1), Unit: "tab", PerDose: NewRational(1, 1), Since: since}}
+	log := &DoseLog{}
+	for i, dose := range []string{"1 tab", "1 tab", "1/2 tab", "1/2 tab", "a spoonful"} {
+		at := since.Add(time.Duration(i+1) * time.Hour)
+		log.Entries = append(log.Entries, DoseEntry{Patient: "a", Medication: "A1", Dose: dose, DueAt: at, Status: DoseTaken, ActedAt: at})
+	}
+
+	// Doses logged before patient profiles, or with other casing, still count
+	at := since.Add(time.Hour)
+	log.Entries = append(log.Entries,
+		DoseEntry{Medication: "a1", Dose: "1 tab", DueAt: at, Status: DoseTaken, ActedAt: at},
+		DoseEntry{Patient: "b", Medication: "A1", Dose: "1 tab", DueAt: at, Status: DoseTaken, ActedAt: at},
+	)
+
+	// Doses that can't be read use PerDose
+	if left := med.StockLeft("a", log); left != NewRational(5, 1) {
+		t.Errorf("got %s left, want 5", left)
+	}
+}
+
+func TestStockReadsFloatAmounts(t *testing.T) {
+	var stock Stock
+	if err := json.Unmarshal([]byte(`{"amount":7.5,"unit":"tab","per_dose":0.3333333333333333}`), &stock); err != nil {
+		t.Fatal(err)
+	}
+	if stock.Amount != NewRational(15, 2) || stock.PerDose != NewRational(1, 3) {
+		t.Errorf("got %s and %s, want 7 1/2 and 1/3", stock.Amount, stock.PerDose)
+	}
+
+	data, err := json.Marshal(stock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var again Stock
+	if err := json.Unmarshal(data, &again); err != nil || again.Amount != stock.Amount || again.PerDose != stock.PerDose {
+		t.Errorf("%s read back as %+v (%v)", data, again, err)
+	}
+}
+
+func TestStockStatusProjectsRunOut(t *testing.T) {
+	since := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	med := Medication{Name: "A1", Dose: MustParseDose("1/2 tab"), Times: []string{"08:00", "20:00"}, Active: true,
+		Stock: &Stock{Amount: NewRational(3, 2), Unit: "tab", PerDose: NewRational(1, 2), Since: since}}
+
+	// Three half tabs last until the fourth dose
+	status := med.StockStatus("a", &DoseLog{}, since, FixedLocator(time.UTC))
+	if want := time.Date(2026, 3, 2, 20, 0, 0, 0, time.UTC); !status.Projected || !status.RunOut.Equal(want) {
+		t.Errorf("got run out %v (projected %v), want %v", status.RunOut, status.Projected, want)
+	}
+	if !status.Low {
+		t.Error("a supply lasting a day isn't low")
+	}
+
+	// More given than was counted leaves none rather than a negative amount
+	log := &DoseLog{}
+	for i := 0; i < 4; i++ {
+		at := since.Add(time.Duration(i+1) * time.Hour)
+		log.Entries = append(log.Entries, DoseEntry{Patient: "a", Medication: "A1", Dose: "1/2 tab", DueAt: at, Status: DoseTaken, ActedAt: at})
+	}
+	if left := med.StockLeft("a", log); !left.IsZero() {
+		t.Errorf("got %s left, want 0", left)
+	}
+}
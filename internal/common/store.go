@@ -0,0 +1,317 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Store keeps the patients with their medications and the dose log. Everyday changes are
+// written one patient, medication or dose at a time, so a write doesn't get slower as the
+// history grows.
+type Store interface {
+	// LoadSchedule returns every patient with their medications, or nil when nothing was saved yet
+	LoadSchedule() (*MedicationSchedule, error)
+	// SaveSchedule replaces the whole schedule, when it is seeded, migrated or imported
+	SaveSchedule(schedule *MedicationSchedule) error
+	// SaveScheduleChanges writes the patients and medications a transaction changed
+	SaveScheduleChanges(changes *ScheduleChanges) error
+	// LoadDoseLog returns every reminded dose, an empty log when none was saved yet
+	LoadDoseLog() (*DoseLog, error)
+	// SaveDoseChanges appends new doses to the log and updates changed ones in place
+	SaveDoseChanges(changes *DoseChanges) error
+	// Setting returns the value saved under key, and whether one was
+	Setting(key string) (string, bool, error)
+	// SetSetting saves a value under key, replacing the one before
+	SetSetting(key, value string) error
+	Close() error
+}
+
+// ScheduleChanges is what one transaction changed in the schedule. Patients and
+// medications are written at their position in their list; removing one moves the
+// ones after it up, so they are written again too.
+type ScheduleChanges struct {
+	Version     int
+	LastUpdated string
+	// Patients were added, or had their own fields or position changed. Their
+	// medications are left out, only Medications changes those.
+	Patients []PatientChange
+	// RemovedPatients are the IDs of patients removed along with their medications
+	RemovedPatients []string
+	// Medications were added or changed, in the order of their positions
+	Medications []MedicationChange
+	// MedicationCounts maps the ID of each patient who lost medications to how many are left
+	MedicationCounts map[string]int
+}
+
+// PatientChange is a patient written at a position in the patient list
+type PatientChange struct {
+	Position int
+	Patient  Patient
+}
+
+// MedicationChange is a medication written at a position in its patient's list
+type MedicationChange struct {
+	PatientID  string
+	Position   int
+	Medication Medication
+}
+
+// Empty reports whether no patient or medication changed
+func (c *ScheduleChanges) Empty() bool {
+	return len(c.Patients) == 0 && len(c.RemovedPatients) == 0 && len(c.Medications) == 0 && len(c.MedicationCounts) == 0
+}
+
+// apply makes the changes to a whole schedule, for stores that keep it in one piece
+func (c *ScheduleChanges) apply(schedule *MedicationSchedule) {
+	schedule.Version = c.Version
+	schedule.LastUpdated = c.LastUpdated
+
+	removed := make(map[string]bool, len(c.RemovedPatients))
+	for _, id := range c.RemovedPatients {
+		removed[id] = true
+	}
+	kept := schedule.Patients[:0]
+	for _, patient := range schedule.Patients {
+		if !removed[patient.ID] {
+			kept = append(kept, patient)
+		}
+	}
+	schedule.Patients = kept
+
+	// Patients never move except up when one before them is removed, so a changed
+	// patient is either already in place or new at the end
+	for _, change := range c.Patients {
+		patient := change.Patient
+		if p := patientIndex(schedule, patient.ID); p >= 0 {
+			patient.Medications = schedule.Patients[p].Medications
+			schedule.Patients[p] = patient
+			continue
+		}
+		patient.Medications = []Medication{}
+		schedule.Patients = append(schedule.Patients, patient)
+	}
+
+	for id, count := range c.MedicationCounts {
+		if p := patientIndex(schedule, id); p >= 0 && count < len(schedule.Patients[p].Medications) {
+			schedule.Patients[p].Medications = schedule.Patients[p].Medications[:count]
+		}
+	}
+	for _, change := range c.Medications {
+		p := patientIndex(schedule, change.PatientID)
+		if p < 0 {
+			continue
+		}
+		meds := &schedule.Patients[p].Medications
+		if change.Position < len(*meds) {
+			(*meds)[change.Position] = change.Medication
+		} else {
+			*meds = append(*meds, change.Medication)
+		}
+	}
+}
+
+// diffSchedule finds the patients and medications updated changed compared to old
+func diffSchedule(old, updated *MedicationSchedule) (*ScheduleChanges, error) {
+	changes := &ScheduleChanges{
+		Version:          updated.Version,
+		LastUpdated:      updated.LastUpdated,
+		MedicationCounts: make(map[string]int),
+	}
+
+	seen := make(map[string]bool, len(updated.Patients))
+	for p := range updated.Patients {
+		patient := updated.Patients[p]
+		seen[patient.ID] = true
+
+		var before Patient
+		position := patientIndex(old, patient.ID)
+		if position >= 0 {
+			before = old.Patients[position]
+		}
+		meds, beforeMeds := patient.Medications, before.Medications
+		patient.Medications, before.Medications = nil, nil
+		same, err := sameJSON(before, patient)
+		if err != nil {
+			return nil, err
+		}
+		if position != p || !same {
+			changes.Patients = append(changes.Patients, PatientChange{Position: p, Patient: patient})
+		}
+
+		for m := range meds {
+			if m < len(beforeMeds) {
+				if same, err := sameJSON(beforeMeds[m], meds[m]); err != nil {
+					return nil, err
+				} else if same {
+					continue
+				}
+			}
+			changes.Medications = append(changes.Medications, MedicationChange{PatientID: patient.ID, Position: m, Medication: meds[m]})
+		}
+		if len(meds) < len(beforeMeds) {
+			changes.MedicationCounts[patient.ID] = len(meds)
+		}
+	}
+
+	for _, patient := range old.Patients {
+		if !seen[patient.ID] {
+			changes.RemovedPatients = append(changes.RemovedPatients, patient.ID)
+		}
+	}
+	return changes, nil
+}
+
+// sameJSON reports whether a and b are saved the same way
+func sameJSON(a, b any) (bool, error) {
+	dataA, err := json.Marshal(a)
+	if err != nil {
+		return false, err
+	}
+	dataB, err := json.Marshal(b)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(dataA, dataB), nil
+}
+
+// patientIndex returns the position of the patient with exactly this ID, -1 when there is none
+func patientIndex(schedule *MedicationSchedule, id string) int {
+	for p := range schedule.Patients {
+		if schedule.Patients[p].ID == id {
+			return p
+		}
+	}
+	return -1
+}
+
+// DoseChanges is what one update changed in the dose log, which only ever grows
+type DoseChanges struct {
+	// Updated maps the position of every changed entry to its new value
+	Updated map[int]DoseEntry
+	// Appended are new entries after the last one
+	Appended []DoseEntry
+}
+
+// Empty reports whether no dose changed
+func (c *DoseChanges) Empty() bool {
+	return len(c.Updated) == 0 && len(c.Appended) == 0
+}
+
+// apply makes the changes to a whole dose log, for stores that keep it in one piece
+func (c *DoseChanges) apply(log *DoseLog) error {
+	for idx, entry := range c.Updated {
+		if idx >= len(log.Entries) {
+			return fmt.Errorf("dose %d isn't in the log", idx)
+		}
+		log.Entries[idx] = entry
+	}
+	log.Entries = append(log.Entries, c.Appended...)
+	return nil
+}
+
+// diffDoseLog finds the doses changed or added compared to the entries before
+func diffDoseLog(before, after []DoseEntry) (*DoseChanges, error) {
+	if len(after) < len(before) {
+		return nil, fmt.Errorf("doses can't be removed from the dose log")
+	}
+	changes := &DoseChanges{Updated: make(map[int]DoseEntry)}
+	for idx := range before {
+		if before[idx] != after[idx] {
+			changes.Updated[idx] = after[idx]
+		}
+	}
+	changes.Appended = after[len(before):]
+	return changes, nil
+}
+
+// Storage backends selectable in the config
+const (
+	StorageJSON   = "json"
+	StorageSQLite = "sqlite"
+)
+
+var (
+	storeMutex sync.RWMutex
+	// store defaults to the JSON files in the working directory, as before stores were configurable
+	store Store = NewJSONStore(stateFile, doseLogFile, settingsFile, defaultStateBackups)
+)
+
+// OpenStore opens the storage backend named in the config. A new SQLite database starts
+// with whatever the JSON files hold, so switching keeps the schedule and dose history.
+// The JSON files keep backups previous versions, defaultStateBackups when 0.
+func OpenStore(kind, path string, backups int) (Store, error) {
+	if backups <= 0 {
+		backups = defaultStateBackups
+	}
+	switch strings.ToLower(strings.TrimSpace(kind)) {
+	case "", StorageJSON:
+		return NewJSONStore(stateFile, doseLogFile, settingsFile, backups), nil
+	case StorageSQLite:
+		s, err := OpenSQLiteStore(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := importJSONStore(s, NewJSONStore(stateFile, doseLogFile, settingsFile, backups)); err != nil {
+			s.Close()
+			return nil, err
+		}
+		return s, nil
+	}
+	return nil, fmt.Errorf("unknown storage %q, expected %s or %s", kind, StorageJSON, StorageSQLite)
+}
+
+// SetStore replaces the store every load and save goes through
+func SetStore(s Store) {
+	storeMutex.Lock()
+	store = s
+	storeMutex.Unlock()
+	states.reset(s)
+}
+
+// currentStore returns the store in use
+func currentStore() Store {
+	storeMutex.RLock()
+	defer storeMutex.RUnlock()
+	return store
+}
+
+// importJSONStore copies the JSON files into an empty store
+func importJSONStore(dst Store, src *JSONStore) error {
+	existing, err := dst.LoadSchedule()
+	if err != nil || existing != nil {
+		return err
+	}
+	schedule, err := src.LoadSchedule()
+	if err != nil || schedule == nil {
+		return err
+	}
+	doseLog, err := src.LoadDoseLog()
+	if err != nil {
+		return err
+	}
+
+	// Older files are brought up to date before they're split into tables
+	if _, err := migrateLoaded(schedule); err != nil {
+		return err
+	}
+	if err := dst.SaveSchedule(schedule); err != nil {
+		return err
+	}
+	if err := dst.SaveDoseChanges(&DoseChanges{Appended: doseLog.Entries}); err != nil {
+		return err
+	}
+	settings, err := src.settings()
+	if err != nil {
+		return err
+	}
+	for key, value := range settings {
+		if err := dst.SetSetting(key, value); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Imported %d patients and %d logged doses from %s into the database\n", len(schedule.Patients), len(doseLog.Entries), src.statePath)
+	return nil
+}
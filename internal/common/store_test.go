@@ -0,0 +1,144 @@
+package common
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testStores returns an empty store of every backend
+func testStores(t *testing.T) map[string]Store {
+	t.Helper()
+	dir := t.TempDir()
+	db, err := OpenSQLiteStore(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return map[string]Store{
+		StorageJSON:   NewJSONStore(filepath.Join(dir, stateFile), filepath.Join(dir, doseLogFile), filepath.Join(dir, settingsFile), 2),
+		StorageSQLite: db,
+	}
+}
+
+func TestScheduleChangesRoundTrip(t *testing.T) {
+	steps := []func(schedule *MedicationSchedule) error{
+		func(schedule *MedicationSchedule) error {
+			schedule.Patients = append(schedule.Patients,
+				Patient{ID: "a", Name: "A", Medications: []Medication{{Name: "A1"}, {Name: "A2"}, {Name: "A3"}}},
+				Patient{ID: "b", Name: "B", Medications: []Medication{{Name: "B1"}}},
+				Patient{ID: "c", Name: "C", Medications: []Medication{}},
+			)
+			return nil
+		},
+		func(schedule *MedicationSchedule) error {
+			// Removing from the middle moves the rest up
+			a := schedule.Patient("a")
+			a.Medications = append(a.Medications[:1], a.Medications[2:]...)
+			a.Timezone = "Europe/Berlin"
+			return nil
+		},
+		func(schedule *MedicationSchedule) error {
+			schedule.Patients = append(schedule.Patients[:1], schedule.Patients[2:]...)
+			schedule.Patient("c").Medications = append(schedule.Patient("c").Medications, Medication{Name: "C1", Active: true})
+			return nil
+		},
+		func(schedule *MedicationSchedule) error {
+			schedule.Patient("a").Medications[0].Notes = "Changed"
+			schedule.Patients = append(schedule.Patients, Patient{ID: "d", Name: "D", Medications: []Medication{{Name: "D1"}}})
+			return nil
+		},
+	}
+
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			if err := store.SaveSchedule(&MedicationSchedule{Version: SchemaVersion, Patients: []Patient{}}); err != nil {
+				t.Fatalf("seeding: %v", err)
+			}
+			service := NewStateService(store)
+			for n, step := range steps {
+				if err := service.Update(step); err != nil {
+					t.Fatalf("step %d: %v", n+1, err)
+				}
+
+				want, err := service.Snapshot()
+				if err != nil {
+					t.Fatalf("snapshot: %v", err)
+				}
+				got, err := store.LoadSchedule()
+				if err != nil {
+					t.Fatalf("load: %v", err)
+				}
+				if same, err := sameJSON(got, want); err != nil || !same {
+					t.Fatalf("after step %d the store holds %+v, want %+v", n+1, got.Patients, want.Patients)
+				}
+			}
+		})
+	}
+}
+
+func TestDoseChangesRoundTrip(t *testing.T) {
+	at := time.Date(2026, 1, 2, 8, 0, 0, 0, time.UTC)
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			first := []DoseEntry{
+				{ReminderID: "r1", Patient: "a", Medication: "A1", DueAt: at, Status: DosePending},
+				{ReminderID: "r1", Patient: "a", Medication: "A2", DueAt: at, Status: DosePending},
+			}
+			if err := store.SaveDoseChanges(&DoseChanges{Appended: first}); err != nil {
+				t.Fatalf("append: %v", err)
+			}
+
+			taken := first[1]
+			taken.Status = DoseTaken
+			third := DoseEntry{ReminderID: "r2", Patient: "a", Medication: "A1", DueAt: at.Add(time.Hour), Status: DosePending}
+			if err := store.SaveDoseChanges(&DoseChanges{Updated: map[int]DoseEntry{1: taken}, Appended: []DoseEntry{third}}); err != nil {
+				t.Fatalf("update: %v", err)
+			}
+
+			log, err := store.LoadDoseLog()
+			if err != nil {
+				t.Fatalf("load: %v", err)
+			}
+			want := []DoseEntry{first[0], taken, third}
+			if same, err := sameJSON(log.Entries, want); err != nil || !same {
+				t.Fatalf("got %+v, want %+v", log.Entries, want)
+			}
+			if err := store.SaveDoseChanges(&DoseChanges{Updated: map[int]DoseEntry{5: third}}); err == nil {
+				t.Errorf("updating a dose past the end of the log succeeded")
+			}
+		})
+	}
+}
+
+func TestSettingsRoundTrip(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			if _, saved, err := store.Setting("admin_channel"); err != nil || saved {
+				t.Fatalf("got saved %v (%v) before anything was saved", saved, err)
+			}
+			for _, value := range []string{"123", "456"} {
+				if err := store.SetSetting("admin_channel", value); err != nil {
+					t.Fatalf("saving %s: %v", value, err)
+				}
+			}
+			if err := store.SetSetting("timezone", "Europe/Berlin"); err != nil {
+				t.Fatalf("saving timezone: %v", err)
+			}
+			if value, saved, err := store.Setting("admin_channel"); err != nil || !saved || value != "456" {
+				t.Errorf("got %q, %v, %v, want the last value saved", value, saved, err)
+			}
+
+			// Settings live next to the schedule without either changing the other
+			if err := store.SaveSchedule(&MedicationSchedule{Version: SchemaVersion, Patients: []Patient{}}); err != nil {
+				t.Fatalf("saving schedule: %v", err)
+			}
+			if value, _, err := store.Setting("timezone"); err != nil || value != "Europe/Berlin" {
+				t.Errorf("got timezone %q (%v) after saving the schedule", value, err)
+			}
+			if schedule, err := store.LoadSchedule(); err != nil || schedule.Version != SchemaVersion {
+				t.Errorf("got schedule %+v (%v) after saving settings", schedule, err)
+			}
+		})
+	}
+}
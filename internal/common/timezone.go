@@ -0,0 +1,98 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	// Embedded zone database, so timezones load on hosts without one
+	_ "time/tzdata"
+)
+
+// defaultTimezone is where the original patients live, UTC+8 all year round
+const defaultTimezone = "Asia/Manila"
+
+// DefaultLocation is the timezone of patients who haven't set one
+var DefaultLocation = mustLoadLocation(defaultTimezone)
+
+// mustLoadLocation loads a timezone that is known to exist in the embedded database
+func mustLoadLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		panic(err)
+	}
+	return loc
+}
+
+// Locator returns the timezone in effect at an instant, so plans spanning several days
+// follow a patient's travel from day to day
+type Locator func(at time.Time) *time.Location
+
+// FixedLocator is a Locator that is always loc
+func FixedLocator(loc *time.Location) Locator {
+	return func(time.Time) *time.Location { return loc }
+}
+
+// SetDefaultTimezone changes the timezone used for patients who haven't set one
+func SetDefaultTimezone(name string) error {
+	if name == "" {
+		return nil
+	}
+	loc, err := LoadTimezone(name)
+	if err != nil {
+		return err
+	}
+	DefaultLocation = loc
+	return nil
+}
+
+// LoadTimezone loads an IANA timezone like "Europe/Berlin". "Local" and the empty name
+// are refused, since they depend on the host the bot happens to run on.
+func LoadTimezone(name string) (*time.Location, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || strings.EqualFold(name, "local") {
+		return nil, fmt.Errorf("please give an IANA timezone like Asia/Manila or Europe/Berlin")
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown timezone %q, expected an IANA name like Asia/Manila or Europe/Berlin", name)
+	}
+	return loc, nil
+}
+
+// LocalTime returns the instant a wall clock time happens on the given date in loc,
+// correcting for daylight saving transitions: a time the clocks skip over happens the
+// moment they jump forward, and a time that happens twice only counts the first time.
+func LocalTime(year int, month time.Month, day, hour, minute int, loc *time.Location) time.Time {
+	wall := time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+
+	// Try the offsets in effect a day before and a day after, keeping the earliest match
+	var found time.Time
+	for _, probe := range []time.Time{wall.Add(-24 * time.Hour), wall.Add(24 * time.Hour)} {
+		_, offset := probe.In(loc).Zone()
+		candidate := wall.Add(-time.Duration(offset) * time.Second).In(loc)
+		if !sameWallClock(candidate, wall) {
+			continue
+		}
+		if found.IsZero() || candidate.Before(found) {
+			found = candidate
+		}
+	}
+	if !found.IsZero() {
+		return found
+	}
+
+	// Skipped by a jump forward: with the earlier offset the time lands after the jump,
+	// and the zone it lands in starts right at the jump
+	_, before := wall.Add(-24 * time.Hour).In(loc).Zone()
+	start, _ := wall.Add(-time.Duration(before) * time.Second).In(loc).ZoneBounds()
+	if start.IsZero() {
+		return time.Date(year, month, day, hour, minute, 0, 0, loc)
+	}
+	return start.In(loc)
+}
+
+// sameWallClock reports whether t shows the same date and time of day as wall
+func sameWallClock(t, wall time.Time) bool {
+	return t.Year() == wall.Year() && t.YearDay() == wall.YearDay() && t.Hour() == wall.Hour() && t.Minute() == wall.Minute()
+}
@@ -0,0 +1,74 @@
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLocalTimeAcrossDST(t *testing.T) {
+	newYork := mustLoadLocation("America/New_York")
+	lordHowe := mustLoadLocation("Australia/Lord_Howe")
+	utc := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2026, month, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name   string
+		loc    *time.Location
+		month  time.Month
+		day    int
+		hour   int
+		minute int
+		want   time.Time
+	}{
+		{"New York, ordinary time", newYork, time.March, 7, 8, 0, utc(time.March, 7, 13, 0)},
+		{"New York, skipped at spring forward", newYork, time.March, 8, 2, 30, utc(time.March, 8, 7, 0)},
+		{"New York, after spring forward", newYork, time.March, 8, 8, 0, utc(time.March, 8, 12, 0)},
+		{"New York, repeated at fall back", newYork, time.November, 1, 1, 30, utc(time.November, 1, 5, 30)},
+		{"New York, after fall back", newYork, time.November, 1, 8, 0, utc(time.November, 1, 13, 0)},
+		{"Lord Howe, repeated at the 30 minute fall back", lordHowe, time.April, 5, 1, 45, utc(time.April, 4, 14, 45)},
+		{"Lord Howe, after fall back", lordHowe, time.April, 5, 8, 0, utc(time.April, 4, 21, 30)},
+		{"Lord Howe, skipped at the 30 minute spring forward", lordHowe, time.October, 4, 2, 15, utc(time.October, 3, 15, 30)},
+		{"Lord Howe, after spring forward", lordHowe, time.October, 4, 8, 0, utc(time.October, 3, 21, 0)},
+	}
+	for _, tt := range tests {
+		got := LocalTime(2026, tt.month, tt.day, tt.hour, tt.minute, tt.loc)
+		if !got.Equal(tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got.UTC(), tt.want)
+		}
+	}
+}
+
+func TestNextDoseTimeAcrossDST(t *testing.T) {
+	newYork := mustLoadLocation("America/New_York")
+	lordHowe := mustLoadLocation("Australia/Lord_Howe")
+	utc := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2026, month, day, hour, minute, 0, 0, time.UTC)
+	}
+	daily := func(at string) Medication {
+		return Medication{Name: "A1", Times: []string{at}, Active: true, Start: utc(time.January, 1, 0, 0)}
+	}
+
+	tests := []struct {
+		name string
+		med  Medication
+		loc  *time.Location
+		now  time.Time
+		want time.Time
+	}{
+		{"skipped dose moves to the jump", daily("02:30"), newYork, utc(time.March, 7, 8, 0), utc(time.March, 8, 7, 0)},
+		{"back to 02:30 the day after", daily("02:30"), newYork, utc(time.March, 8, 7, 0), utc(time.March, 9, 6, 30)},
+		{"repeated dose comes first time", daily("01:30"), newYork, utc(time.October, 31, 6, 0), utc(time.November, 1, 5, 30)},
+		{"repeated dose isn't given twice", daily("01:30"), newYork, utc(time.November, 1, 5, 30), utc(time.November, 2, 6, 30)},
+		{"morning dose on the new offset", daily("08:00"), newYork, utc(time.March, 7, 13, 0), utc(time.March, 8, 12, 0)},
+		{"Lord Howe skipped dose", daily("02:15"), lordHowe, utc(time.October, 3, 1, 0), utc(time.October, 3, 15, 30)},
+		{"Lord Howe repeated dose", daily("01:45"), lordHowe, utc(time.April, 4, 1, 0), utc(time.April, 4, 14, 45)},
+		{"Lord Howe repeated dose isn't given twice", daily("01:45"), lordHowe, utc(time.April, 4, 14, 45), utc(time.April, 5, 15, 15)},
+	}
+	for _, tt := range tests {
+		got, ok := tt.med.NextDoseTime(tt.now, FixedLocator(tt.loc))
+		if !ok || !got.Equal(tt.want) {
+			t.Errorf("%s: got %v (%v), want %v", tt.name, got.UTC(), ok, tt.want)
+		}
+	}
+}
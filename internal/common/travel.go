@@ -0,0 +1,289 @@
+package common
+
+import (
+	"fmt"
+	"time"
+)
+
+// TravelPlan moves a patient's schedule to another timezone a little each day, so
+// crossing several zones doesn't double up or skip doses. Until departure the times
+// stay in Origin; from then on they move by up to StepMinutes a day until they are
+// in Destination.
+type TravelPlan struct {
+	Origin      string `json:"origin"`
+	Destination string `json:"destination"`
+	Departure   string `json:"departure"` // YYYY-MM-DD in the origin timezone
+	StepMinutes int    `json:"step_minutes"`
+}
+
+// TravelDay is how far the schedule has moved on one day of a travel plan
+type TravelDay struct {
+	Date  time.Time // midnight in the origin timezone
+	Shift int       // minutes the times have moved towards the destination
+}
+
+// NewTravelPlan plans a move from one timezone to another. A zero step picks 1 hour a
+// day for small moves and 2 hours for larger ones.
+func NewTravelPlan(origin, destination *time.Location, departure time.Time, stepHours int) (*TravelPlan, error) {
+	if origin.String() == destination.String() {
+		return nil, fmt.Errorf("the schedule is already in %s", destination)
+	}
+
+	plan := &TravelPlan{
+		Origin:      origin.String(),
+		Destination: destination.String(),
+		Departure:   departure.In(origin).Format("2006-01-02"),
+	}
+	total := plan.totalShift()
+	if total == 0 {
+		return nil, fmt.Errorf("%s and %s are on the same time on %s, nothing to shift", origin, destination, plan.Departure)
+	}
+
+	switch {
+	case stepHours > 0:
+		plan.StepMinutes = stepHours * 60
+	case abs(total) <= 4*60:
+		plan.StepMinutes = 60
+	default:
+		plan.StepMinutes = 120
+	}
+	return plan, nil
+}
+
+// locations loads the origin and destination timezones
+func (t *TravelPlan) locations() (*time.Location, *time.Location, error) {
+	origin, err := LoadTimezone(t.Origin)
+	if err != nil {
+		return nil, nil, err
+	}
+	destination, err := LoadTimezone(t.Destination)
+	if err != nil {
+		return nil, nil, err
+	}
+	return origin, destination, nil
+}
+
+// departure returns noon of the departure day in the origin timezone
+func (t *TravelPlan) departure(origin *time.Location) (time.Time, error) {
+	date, err := time.ParseInLocation("2006-01-02", t.Departure, origin)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return date.Add(12 * time.Hour), nil
+}
+
+// totalShift returns the minutes the schedule moves in all, the shorter way round the clock
+func (t *TravelPlan) totalShift() int {
+	origin, destination, err := t.locations()
+	if err != nil {
+		return 0
+	}
+	at, err := t.departure(origin)
+	if err != nil {
+		return 0
+	}
+
+	_, from := at.In(origin).Zone()
+	_, to := at.In(destination).Zone()
+	shift := (to - from) / 60
+	if shift > 12*60 {
+		shift -= 24 * 60
+	} else if shift < -12*60 {
+		shift += 24 * 60
+	}
+	return shift
+}
+
+// shiftOn returns the minutes the schedule has moved on the origin day containing t
+func (t *TravelPlan) shiftOn(at time.Time) int {
+	origin, _, err := t.locations()
+	if err != nil {
+		return 0
+	}
+	start, err := t.departure(origin)
+	if err != nil {
+		return 0
+	}
+
+	local := at.In(origin)
+	today := time.Date(local.Year(), local.Month(), local.Day(), 12, 0, 0, 0, origin)
+	days := int(today.Sub(start).Round(24*time.Hour).Hours()/24) + 1
+	if days < 1 {
+		return 0
+	}
+
+	total := t.totalShift()
+	moved := days * t.StepMinutes
+	if moved >= abs(total) {
+		return total
+	}
+	if total < 0 {
+		return -moved
+	}
+	return moved
+}
+
+// Done reports whether the schedule has fully moved to the destination at t
+func (t *TravelPlan) Done(at time.Time) bool {
+	return t.shiftOn(at) == t.totalShift()
+}
+
+// Location returns the timezone the schedule's times are in at t: the origin before
+// departure, the destination once the move is done, and a fixed offset in between
+func (t *TravelPlan) Location(at time.Time) (*time.Location, error) {
+	origin, destination, err := t.locations()
+	if err != nil {
+		return nil, err
+	}
+
+	shift := t.shiftOn(at)
+	switch {
+	case shift == 0:
+		return origin, nil
+	case shift == t.totalShift():
+		return destination, nil
+	}
+
+	_, offset := at.In(origin).Zone()
+	offset += shift * 60
+	return time.FixedZone(formatOffset(offset), offset), nil
+}
+
+// Days lists every day of the move, from departure until the schedule is in the destination
+func (t *TravelPlan) Days() []TravelDay {
+	origin, _, err := t.locations()
+	if err != nil {
+		return nil
+	}
+	start, err := t.departure(origin)
+	if err != nil {
+		return nil
+	}
+
+	total := t.totalShift()
+	var days []TravelDay
+	for d := 0; d <= 24; d++ {
+		noon := start.AddDate(0, 0, d)
+		shift := t.shiftOn(noon)
+		days = append(days, TravelDay{
+			Date:  time.Date(noon.Year(), noon.Month(), noon.Day(), 0, 0, 0, 0, origin),
+			Shift: shift,
+		})
+		if shift == total {
+			break
+		}
+	}
+	return days
+}
+
+// FormatTravelPlan previews how a patient's schedule moves day by day
+func FormatTravelPlan(patient *Patient) string {
+	plan := patient.Travel
+	if plan == nil {
+		return ""
+	}
+
+	message := fmt.Sprintf("✈️ **Travel: %s → %s**, moving up to %s a day from %s\n", plan.Origin, plan.Destination, formatShift(plan.StepMinutes), plan.Departure)
+
+	// Show where the earliest dose of the day lands, as an example
+	example := ""
+	for _, med := range patient.Medications {
+		if med.Active && len(med.Times) > 0 && (example == "" || med.Times[0] < example) {
+			example = med.Times[0]
+		}
+	}
+	if example == "" {
+		example = "08:00"
+	}
+	hour, minute, _ := ParseTimeOfDay(example)
+
+	_, destination, err := plan.locations()
+	if err != nil {
+		return message + fmt.Sprintf("   ⚠️ %v\n", err)
+	}
+	for _, day := range plan.Days() {
+		loc, err := plan.Location(day.Date.Add(12 * time.Hour))
+		if err != nil {
+			continue
+		}
+		at := LocalTime(day.Date.Year(), day.Date.Month(), day.Date.Day(), hour, minute, loc)
+		// A zone further east means the same clock time comes earlier
+		direction := "earlier"
+		if day.Shift < 0 {
+			direction = "later"
+		}
+		message += fmt.Sprintf("   %s: doses %s %s, the %s dose at %s %s\n",
+			day.Date.Format("Mon Jan 2"), formatShift(abs(day.Shift)), direction, example, at.In(destination).Format("15:04"), destination)
+	}
+	return message
+}
+
+// formatShift renders minutes as a duration, e.g. "2h" or "1h30m"
+func formatShift(minutes int) string {
+	if minutes%60 == 0 {
+		return fmt.Sprintf("%dh", minutes/60)
+	}
+	return fmt.Sprintf("%dh%02dm", minutes/60, minutes%60)
+}
+
+// formatOffset names a UTC offset in seconds, e.g. "UTC+05:30"
+func formatOffset(seconds int) string {
+	sign := "+"
+	if seconds < 0 {
+		sign = "-"
+		seconds = -seconds
+	}
+	return fmt.Sprintf("UTC%s%02d:%02d", sign, seconds/3600, seconds%3600/60)
+}
+
+// abs returns the absolute value of n
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// NextTravelStep returns when a travel plan next moves the schedule: right away once it
+// is done, otherwise at the next midnight in the origin timezone
+func (t *TravelPlan) NextTravelStep(now time.Time) (time.Time, bool) {
+	if t.Done(now) {
+		return now, true
+	}
+	origin, _, err := t.locations()
+	if err != nil {
+		return time.Time{}, false
+	}
+	local := now.In(origin)
+	return LocalTime(local.Year(), local.Month(), local.Day()+1, 0, 0, origin), true
+}
+
+// AdvanceTravel moves every patient whose travel plan is done into the destination timezone
+func AdvanceTravel(now time.Time) {
+	err := UpdateMedicationState(func(schedule *MedicationSchedule) error {
+		if !FinishTravel(schedule, now) {
+			return ErrNoChanges
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("Error saving medication state: %v\n", err)
+	}
+}
+
+// FinishTravel moves patients whose travel plan is done into the destination timezone
+func FinishTravel(schedule *MedicationSchedule, now time.Time) bool {
+	changed := false
+	for p := range schedule.Patients {
+		patient := &schedule.Patients[p]
+		if patient.Travel == nil || !patient.Travel.Done(now) {
+			continue
+		}
+
+		fmt.Printf("%s's schedule has moved to %s\n", patient.Name, patient.Travel.Destination)
+		patient.Timezone = patient.Travel.Destination
+		patient.Travel = nil
+		changed = true
+	}
+	return changed
+}
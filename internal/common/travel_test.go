@@ -0,0 +1,30 @@
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextDoseFollowsTomorrowsTravelStep(t *testing.T) {
+	manila := mustLoadLocation("Asia/Manila")
+	tokyo := mustLoadLocation("Asia/Tokyo")
+	patient := &Patient{
+		ID:       "a",
+		Name:     "A",
+		Timezone: "Asia/Manila",
+		Travel:   &TravelPlan{Origin: "Asia/Manila", Destination: "Asia/Tokyo", Departure: "2026-03-10", StepMinutes: 60},
+	}
+	med := Medication{Name: "A1", Times: []string{"08:00"}, Active: true, Start: time.Date(2026, 3, 1, 0, 0, 0, 0, manila)}
+
+	// Planned the evening before departure, tomorrow's dose is already on Tokyo time
+	now := time.Date(2026, 3, 9, 21, 0, 0, 0, manila)
+	next, ok := med.NextDoseTime(now, patient.LocationAt)
+	if want := time.Date(2026, 3, 10, 8, 0, 0, 0, tokyo); !ok || !next.Equal(want) {
+		t.Errorf("next dose at %v, want %v", next, want)
+	}
+
+	at, err := NextOccurrence("08:00", now, patient.LocationAt)
+	if want := time.Date(2026, 3, 10, 8, 0, 0, 0, tokyo); err != nil || !at.Equal(want) {
+		t.Errorf("next reminder at %v (%v), want %v", at, err, want)
+	}
+}
@@ -0,0 +1,175 @@
+package common
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WeightEntry is one weighing of a patient
+type WeightEntry struct {
+	Kg float64   `json:"kg"`
+	At time.Time `json:"at"`
+}
+
+// Concentration is how much drug a liquid holds, e.g. 50 mg per 1 ml
+type Concentration struct {
+	Mg float64 `json:"mg"`
+	Ml float64 `json:"ml"`
+}
+
+// DoseChange is a weight-based dose that a new weight changed
+type DoseChange struct {
+	Medication string
+	From, To   Dose
+}
+
+// concentrationPattern finds a concentration like "50mg/ml" or "250 mg / 5 ml"
+var concentrationPattern = regexp.MustCompile(`(?i)(\d+(?:\.\d+)?)\s*mg\s*/\s*(\d+(?:\.\d+)?)?\s*ml`)
+
+// ParseConcentration reads a concentration like "50mg/ml" or "250 mg/5 ml"
+func ParseConcentration(value string) (*Concentration, error) {
+	match := concentrationPattern.FindStringSubmatch(value)
+	if match == nil {
+		return nil, fmt.Errorf("invalid concentration %q, expected e.g. 50mg/ml or 250mg/5ml", value)
+	}
+	mg, _ := strconv.ParseFloat(match[1], 64)
+	ml := 1.0
+	if match[2] != "" {
+		ml, _ = strconv.ParseFloat(match[2], 64)
+	}
+	if mg <= 0 || ml <= 0 {
+		return nil, fmt.Errorf("a concentration must be more than zero")
+	}
+	return &Concentration{Mg: mg, Ml: ml}, nil
+}
+
+// String renders the concentration, e.g. "50 mg/ml" or "250 mg/5 ml"
+func (c Concentration) String() string {
+	mg := strconv.FormatFloat(c.Mg, 'f', -1, 64)
+	if c.Ml == 1 {
+		return mg + " mg/ml"
+	}
+	return fmt.Sprintf("%s mg/%s ml", mg, strconv.FormatFloat(c.Ml, 'f', -1, 64))
+}
+
+// Weight returns the patient's latest recorded weight
+func (p *Patient) Weight() (WeightEntry, bool) {
+	if len(p.Weights) == 0 {
+		return WeightEntry{}, false
+	}
+	return p.Weights[len(p.Weights)-1], true
+}
+
+// concentration returns the medication's concentration, read from its name when not set,
+// e.g. "Doxycycline Hydrochloride 50mg/ml"
+func (m Medication) concentration() *Concentration {
+	if m.Concentration != nil {
+		return m.Concentration
+	}
+	c, err := ParseConcentration(m.Name)
+	if err != nil {
+		return nil
+	}
+	return c
+}
+
+// WeightDose computes a weight-based dose: mg/kg times the weight, given as the volume
+// holding that much when the concentration is known, rounded to 0.1 ml
+func (m Medication) WeightDose(kg float64) (Dose, float64, bool) {
+	if m.MgPerKg <= 0 || kg <= 0 {
+		return Dose{}, 0, false
+	}
+	mg := m.MgPerKg * kg
+
+	amount, unit := mg, UnitMG
+	if c := m.concentration(); c != nil {
+		amount, unit = mg*c.Ml/c.Mg, UnitML
+	}
+	tenths := int64(math.Round(amount * 10))
+	if tenths <= 0 {
+		return Dose{}, mg, false
+	}
+	return Dose{Amount: NewRational(tenths, 10), Unit: unit}, mg, true
+}
+
+// WeightBasis explains how a weight-based dose was worked out, e.g. "110 mg: 5 mg/kg × 22 kg at 50 mg/ml"
+func (m Medication) WeightBasis(patient *Patient) string {
+	weight, ok := patient.Weight()
+	if m.MgPerKg <= 0 || !ok {
+		return ""
+	}
+	_, mg, ok := m.WeightDose(weight.Kg)
+	if !ok {
+		return ""
+	}
+
+	text := fmt.Sprintf("%s mg: %s mg/kg × %s kg", formatAmount(mg), formatAmount(m.MgPerKg), formatAmount(weight.Kg))
+	if c := m.concentration(); c != nil {
+		text += " at " + c.String()
+	}
+	return text
+}
+
+// formatAmount renders a measured amount with at most two decimals
+func formatAmount(value float64) string {
+	return strconv.FormatFloat(math.Round(value*100)/100, 'f', -1, 64)
+}
+
+// ApplyWeightDose sets a weight-based medication's dose from the patient's latest weight
+// and reports the change, if any. A supply counted in the dose's unit is recounted as of
+// now, so the doses already given keep the amount they used.
+func ApplyWeightDose(patient *Patient, med *Medication, log *DoseLog, now time.Time) (DoseChange, bool) {
+	weight, ok := patient.Weight()
+	if !ok {
+		return DoseChange{}, false
+	}
+	dose, _, ok := med.WeightDose(weight.Kg)
+	if !ok || dose.String() == med.Dose.String() {
+		return DoseChange{}, false
+	}
+
+	if med.Stock != nil && med.Stock.Unit == string(dose.Unit) {
+		med.Stock.Amount = med.StockLeft(patient.ID, log)
+		med.Stock.Since = now
+		med.Stock.PerDose = dose.Amount
+	}
+	change := DoseChange{Medication: med.Name, From: med.Dose, To: dose}
+	med.Dose = dose
+	return change, true
+}
+
+// RecordWeight adds a weighing to the patient's history and recomputes every weight-based
+// dose, returning the doses it changed
+func RecordWeight(patient *Patient, kg float64, at time.Time, log *DoseLog) ([]DoseChange, error) {
+	if kg <= 0 || kg > 1000 {
+		return nil, fmt.Errorf("a weight must be between 0 and 1000 kg")
+	}
+
+	patient.Weights = append(patient.Weights, WeightEntry{Kg: kg, At: at})
+	sort.SliceStable(patient.Weights, func(i, j int) bool { return patient.Weights[i].At.Before(patient.Weights[j].At) })
+
+	var changes []DoseChange
+	for i := range patient.Medications {
+		if change, ok := ApplyWeightDose(patient, &patient.Medications[i], log, at); ok {
+			changes = append(changes, change)
+		}
+	}
+	return changes, nil
+}
+
+// FormatDoseChanges warns about doses a new weight changed
+func FormatDoseChanges(changes []DoseChange) string {
+	if len(changes) == 0 {
+		return ""
+	}
+	lines := make([]string, 0, len(changes))
+	for _, c := range changes {
+		lines = append(lines, fmt.Sprintf("   💊 **%s**: %s → **%s**", c.Medication, c.From, c.To))
+	}
+	return "⚠️ **The new weight changes these doses:**\n" + strings.Join(lines, "\n") + "\nPlease double check with the vet or doctor before the next dose."
+}
@@ -3,6 +3,9 @@ package config
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -13,20 +16,62 @@ type Config struct {
 	ServerPort   string
 	AppID        string
 	ServerURL    string
+	// CatchUpGrace is how far back missed reminders are still sent on startup
+	CatchUpGrace time.Duration
+	// DefaultTimezone is the IANA timezone of patients who haven't set their own
+	DefaultTimezone string
+	// Storage picks where the state is kept: "json" files (the default) or "sqlite"
+	Storage string
+	// SQLitePath is the database file of the sqlite storage
+	SQLitePath string
+	// StateBackups is how many previous versions of each JSON state file are kept, 5 when 0
+	StateBackups int
+	// AdminIDs are the Discord users alerted when a state file is unreadable
+	AdminIDs []string
+	// SeedFile is a JSON or YAML file of patients a new schedule starts with, none when empty
+	SeedFile string
+	// DefaultGuildID is the Discord server that patients without one, from older state,
+	// the seed file or the environment, are managed from
+	DefaultGuildID string
 }
 
 var GlobalConfig Config
 
 // LoadConfig initializes the configuration with default values
-func LoadConfig() (error) {
+func LoadConfig() error {
 	if err := godotenv.Load(); err != nil {
 		fmt.Println("Error loading .env file")
 	}
 	GlobalConfig = Config{
-		DiscordToken: os.Getenv("DISCORD_TOKEN"),
-		ServerPort:   os.Getenv("SERVER_PORT"),
-		AppID:        os.Getenv("APP_ID"),
-		ServerURL:    os.Getenv("SERVER_URL"),
+		DiscordToken:    os.Getenv("DISCORD_TOKEN"),
+		ServerPort:      os.Getenv("SERVER_PORT"),
+		AppID:           os.Getenv("APP_ID"),
+		ServerURL:       os.Getenv("SERVER_URL"),
+		DefaultTimezone: os.Getenv("DEFAULT_TIMEZONE"),
+		Storage:         os.Getenv("STORAGE"),
+		SQLitePath:      os.Getenv("SQLITE_PATH"),
+		SeedFile:        os.Getenv("SEED_FILE"),
+		DefaultGuildID:  os.Getenv("DEFAULT_GUILD_ID"),
+	}
+	for _, id := range strings.Split(os.Getenv("ADMIN_IDS"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			GlobalConfig.AdminIDs = append(GlobalConfig.AdminIDs, id)
+		}
+	}
+	GlobalConfig.CatchUpGrace = 2 * time.Hour
+	if grace := os.Getenv("CATCHUP_GRACE"); grace != "" {
+		d, err := time.ParseDuration(grace)
+		if err != nil {
+			return fmt.Errorf("invalid CATCHUP_GRACE %q: %w", grace, err)
+		}
+		GlobalConfig.CatchUpGrace = d
+	}
+	if backups := os.Getenv("STATE_BACKUPS"); backups != "" {
+		n, err := strconv.Atoi(backups)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid STATE_BACKUPS %q, expected a number of files", backups)
+		}
+		GlobalConfig.StateBackups = n
 	}
 	return nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,86 @@
+package scheduler
+
+import (
+	"fmt"
+	"time"
+)
+
+// backoff holds back jobs that are due again right after they ran. Overdue doses,
+// snoozes, escalations and finished travel plans stay due until their job saves what it
+// did, so a save that keeps failing would otherwise run the job over and over.
+type backoff struct {
+	retries map[string]*retry
+}
+
+// retry is what is known about a job that ran
+type retry struct {
+	ranAt time.Time
+	// wait is how long after ranAt the job runs again, 0 until it was due again
+	wait time.Duration
+	// due is set when the latest plan found the job due again
+	due bool
+}
+
+// newBackoff returns a backoff that holds nothing back yet
+func newBackoff() *backoff {
+	return &backoff{retries: make(map[string]*retry)}
+}
+
+// plan starts a new plan, which marks again every job that is still due
+func (b *backoff) plan() {
+	if b == nil {
+		return
+	}
+	for _, r := range b.retries {
+		r.due = false
+	}
+}
+
+// hold returns when a job planned for at may run. A job that already ran and is due
+// right away again failed, and waits at least a minute, twice as long every time.
+func (b *backoff) hold(key string, at, now time.Time) time.Time {
+	if b == nil || at.After(now) {
+		return at
+	}
+	r, ok := b.retries[key]
+	if !ok {
+		return at
+	}
+	r.due = true
+	if r.wait == 0 {
+		r.wait = minRetryDelay
+		fmt.Printf("%s is still due after running, it may not have saved, retrying in %s\n", key, r.wait)
+	}
+	if retryAt := r.ranAt.Add(r.wait); retryAt.After(at) {
+		return retryAt
+	}
+	return at
+}
+
+// forget drops the jobs the plan didn't find due again, they succeeded
+func (b *backoff) forget() {
+	if b == nil {
+		return
+	}
+	for key, r := range b.retries {
+		if !r.due {
+			delete(b.retries, key)
+		}
+	}
+}
+
+// ran records that jobs ran at ranAt, doubling the wait of those that were retries
+func (b *backoff) ran(jobs []job, ranAt time.Time) {
+	for _, j := range jobs {
+		r, ok := b.retries[j.key]
+		if !ok {
+			b.retries[j.key] = &retry{ranAt: ranAt}
+			continue
+		}
+		r.ranAt = ranAt
+		if r.wait > 0 {
+			r.wait = min(r.wait*2, maxRetryDelay)
+			fmt.Printf("%s ran again, retrying in %s if it is still due\n", j.key, r.wait)
+		}
+	}
+}
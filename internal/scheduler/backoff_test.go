@@ -0,0 +1,57 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffDoublesWhileJobStaysDue(t *testing.T) {
+	b := newBackoff()
+	now := time.Date(2026, 1, 1, 8, 0, 0, 0, time.UTC)
+	due := now.Add(-time.Hour)
+
+	// The first run isn't held back
+	b.plan()
+	if at := b.hold("snoozes", due, now); !at.Equal(due) {
+		t.Fatalf("first plan held the job until %s", at)
+	}
+	b.forget()
+
+	wait := minRetryDelay
+	for n := 0; n < 10; n++ {
+		b.ran([]job{{key: "snoozes"}}, now)
+		now = now.Add(time.Second)
+
+		b.plan()
+		at := b.hold("snoozes", due, now)
+		b.forget()
+		if want := now.Add(-time.Second).Add(wait); !at.Equal(want) {
+			t.Fatalf("retry %d at %s, want %s", n+1, at, want)
+		}
+		now = at
+		wait = min(wait*2, maxRetryDelay)
+	}
+}
+
+func TestBackoffForgetsJobsThatSucceeded(t *testing.T) {
+	b := newBackoff()
+	now := time.Date(2026, 1, 1, 8, 0, 0, 0, time.UTC)
+
+	b.ran([]job{{key: "escalations"}, {key: "remind:a"}}, now)
+	now = now.Add(time.Second)
+	b.plan()
+	// Still due: it failed
+	b.hold("escalations", now, now)
+	// Next due in the future: it succeeded
+	if at := b.hold("remind:a", now.Add(time.Hour), now); !at.Equal(now.Add(time.Hour)) {
+		t.Errorf("a job in the future was held until %s", at)
+	}
+	b.forget()
+
+	if _, ok := b.retries["remind:a"]; ok {
+		t.Errorf("a job that succeeded is still tracked")
+	}
+	if _, ok := b.retries["escalations"]; !ok {
+		t.Errorf("a job that failed was forgotten")
+	}
+}
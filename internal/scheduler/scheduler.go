@@ -0,0 +1,263 @@
+package scheduler
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Sush1sui/meds_reminder/internal/common"
+	"github.com/Sush1sui/meds_reminder/internal/config"
+	"github.com/bwmarrin/discordgo"
+)
+
+// job is a single reminder due at a specific instant
+type job struct {
+	// key names what the job does, the same every time it is planned until it is done
+	key string
+	at  time.Time
+	run func(sess *discordgo.Session, at time.Time)
+}
+
+// Delays before retrying a job that didn't save what it did, and before reading the
+// state again when it couldn't be loaded
+const (
+	minRetryDelay     = time.Minute
+	maxRetryDelay     = time.Hour
+	minLoadRetryDelay = 10 * time.Second
+	maxLoadRetryDelay = 5 * time.Minute
+)
+
+// Scheduler fires reminders at the times declared in the medication schedule
+type Scheduler struct {
+	sess    *discordgo.Session
+	replan  chan struct{}
+	retries *backoff
+}
+
+// New creates a scheduler that sends reminders through the given session
+func New(sess *discordgo.Session) *Scheduler {
+	return &Scheduler{
+		sess:    sess,
+		replan:  make(chan struct{}, 1),
+		retries: newBackoff(),
+	}
+}
+
+// Replan asks the scheduler to recompute the next due reminder
+func (s *Scheduler) Replan() {
+	select {
+	case s.replan <- struct{}{}:
+	default:
+	}
+}
+
+// Run plans and fires reminders until the process exits
+func (s *Scheduler) Run() {
+	fmt.Println("Scheduler started.")
+
+	s.catchUp()
+
+	loadRetry := minLoadRetryDelay
+	for {
+		now := time.Now()
+
+		schedule, doseLog, err := load()
+		if err != nil {
+			// Planning without the state would drop every reminder, so it is read again soon
+			fmt.Printf("%v, retrying in %s\n", err, loadRetry)
+			s.wait(loadRetry)
+			loadRetry = min(loadRetry*2, maxLoadRetryDelay)
+			continue
+		}
+		loadRetry = minLoadRetryDelay
+
+		jobs := planNext(schedule, doseLog, now, s.retries)
+		if len(jobs) == 0 {
+			fmt.Println("No reminders scheduled, waiting for schedule changes.")
+			<-s.replan
+			continue
+		}
+
+		at := jobs[0].at
+		fmt.Printf("Next reminder at %s\n", at.Format(time.RFC1123))
+
+		timer := time.NewTimer(time.Until(at))
+		select {
+		case <-timer.C:
+			s.fire(jobs)
+			s.retries.ran(jobs, time.Now())
+		case <-s.replan:
+			timer.Stop()
+		}
+	}
+}
+
+// load reads the schedule and the dose log the next plan is made from
+func load() (*common.MedicationSchedule, *common.DoseLog, error) {
+	schedule, err := common.LoadMedicationState()
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error loading medication state: %w", err)
+	}
+	doseLog, err := common.LoadDoseLog()
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error loading dose log: %w", err)
+	}
+	return schedule, doseLog, nil
+}
+
+// wait sleeps for d, or until the schedule changes
+func (s *Scheduler) wait(d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-s.replan:
+	}
+}
+
+// catchUp sends reminders that came due while the bot was down
+func (s *Scheduler) catchUp() {
+	schedule, err := common.LoadMedicationState()
+	if err != nil {
+		fmt.Printf("Error loading medication state: %v\n", err)
+		return
+	}
+
+	now := time.Now()
+	for _, patient := range schedule.Patients {
+		missed := common.GetMissedReminders(&patient, now, config.GlobalConfig.CatchUpGrace)
+		if len(missed) == 0 {
+			continue
+		}
+
+		fmt.Printf("Catching up on %d missed reminder(s) for %s.\n", len(missed), patient.Name)
+		common.RemindUserLate(s.sess, patient.ID, missed)
+	}
+}
+
+// fire runs the due jobs and waits for them, so the next plan sees what they recorded.
+// Jobs only do local bookkeeping before handing sends off to their own goroutines.
+func (s *Scheduler) fire(jobs []job) {
+	var wg sync.WaitGroup
+	for _, j := range jobs {
+		wg.Add(1)
+		go func(j job) {
+			defer wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					fmt.Printf("reminder panic: %v\n", r)
+				}
+			}()
+			j.run(s.sess, j.at)
+		}(j)
+	}
+	wg.Wait()
+}
+
+// planNext returns the jobs that share the earliest due instant after now, holding back
+// the ones that keep coming due because they failed
+func planNext(schedule *common.MedicationSchedule, doseLog *common.DoseLog, now time.Time, retries *backoff) []job {
+	retries.plan()
+	defer retries.forget()
+
+	var jobs []job
+	add := func(key string, at time.Time, run func(sess *discordgo.Session, at time.Time)) {
+		at = retries.hold(key, at, now)
+		switch {
+		case len(jobs) == 0 || at.Before(jobs[0].at):
+			jobs = []job{{key: key, at: at, run: run}}
+		case at.Equal(jobs[0].at):
+			jobs = append(jobs, job{key: key, at: at, run: run})
+		}
+	}
+
+	for _, patient := range schedule.Patients {
+		patientID := patient.ID
+
+		// All of a patient's medications due at the same instant go out in a single reminder
+		if at, ok := nextMedicationTime(&patient, doseLog, now); ok {
+			add("remind:"+patientID, at, func(sess *discordgo.Session, at time.Time) { common.RemindUser(sess, patientID, at) })
+		}
+
+		// Interval doses that came due while the bot was down or busy go out late right away
+		for _, med := range overdueIntervalDoses(&patient, doseLog, now) {
+			missed := []common.MissedReminder{med}
+			key := fmt.Sprintf("interval:%s:%s:%d", patientID, med.Medications[0].Name, med.DueAt.Unix())
+			add(key, now, func(sess *discordgo.Session, _ time.Time) { common.RemindUserLate(sess, patientID, missed) })
+		}
+
+		// A travel plan moves the times at midnight, so the plan is redone then
+		if patient.Travel != nil {
+			if at, ok := patient.Travel.NextTravelStep(now); ok {
+				add("travel:"+patientID, at, func(sess *discordgo.Session, at time.Time) { common.AdvanceTravel(at) })
+			}
+		}
+
+		for _, t := range patient.SimpleReminderTimes {
+			at, err := common.NextOccurrence(t, now, patient.LocationAt)
+			if err != nil {
+				fmt.Printf("Skipping simple reminder for %s: %v\n", patient.Name, err)
+				continue
+			}
+			add("simple:"+patientID+":"+t, at, func(sess *discordgo.Session, _ time.Time) { common.SendSimpleReminder(sess, patientID) })
+		}
+	}
+
+	// Snoozes that ended while the bot was down are re-armed and fire right away
+	if at, ok := common.NextSnoozeTime(doseLog); ok {
+		if at.Before(now) {
+			at = now
+		}
+		add("snoozes", at, func(sess *discordgo.Session, at time.Time) { common.ResendDueSnoozes(sess, at) })
+	}
+
+	// Escalations that are already overdue fire right away
+	if at, ok := common.NextEscalationTime(schedule, doseLog); ok {
+		if at.Before(now) {
+			at = now
+		}
+		add("escalations", at, func(sess *discordgo.Session, at time.Time) { common.RunEscalations(sess, at) })
+	}
+
+	return jobs
+}
+
+// nextMedicationTime returns the earliest time after now any of the patient's active medications is due
+func nextMedicationTime(patient *common.Patient, doseLog *common.DoseLog, now time.Time) (time.Time, bool) {
+	var next time.Time
+	for _, med := range patient.Medications {
+		// As-needed medications are never reminded
+		if !med.Active || med.PRN != nil {
+			continue
+		}
+
+		var at time.Time
+		var ok bool
+		if med.Interval != nil {
+			at, ok = med.NextIntervalDose(patient.ID, doseLog, now)
+		} else {
+			at, ok = med.NextDoseTime(now, patient.LocationAt)
+		}
+		if ok && (next.IsZero() || at.Before(next)) {
+			next = at
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// overdueIntervalDoses returns interval doses that came due within the catch-up grace
+// window and were never reminded
+func overdueIntervalDoses(patient *common.Patient, doseLog *common.DoseLog, now time.Time) []common.MissedReminder {
+	var missed []common.MissedReminder
+	for _, med := range patient.Medications {
+		if !med.Active || med.Interval == nil {
+			continue
+		}
+
+		at, ok := med.NextIntervalDose(patient.ID, doseLog, now.Add(-config.GlobalConfig.CatchUpGrace))
+		if ok && !at.After(now) {
+			missed = append(missed, common.MissedReminder{DueAt: at, Medications: []common.Medication{med}})
+		}
+	}
+	return missed
+}